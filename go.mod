@@ -3,14 +3,17 @@ module github.com/chazari-x/yandex-pr-diplom
 go 1.20
 
 require (
-	github.com/caarlos0/env/v6 v6.10.1 // indirect
-	github.com/go-chi/chi/v5 v5.0.8 // indirect
+	github.com/caarlos0/env/v6 v6.10.1
+	github.com/go-chi/chi/v5 v5.0.8
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.6.0
+)
+
+require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
 	github.com/jackc/pgx/v5 v5.3.1 // indirect
 	github.com/jackc/puddle/v2 v2.2.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
-	golang.org/x/crypto v0.6.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/text v0.7.0 // indirect
 )
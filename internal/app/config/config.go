@@ -1,8 +1,14 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"flag"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	_ "github.com/lib/pq"
@@ -11,9 +17,34 @@ import (
 var C Config
 
 type Config struct {
-	RunAddress           string `env:"RUN_ADDRESS"`
-	DataBaseURI          string `env:"DATABASE_URI"`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	RunAddress           string        `env:"RUN_ADDRESS"`
+	DataBaseURI          string        `env:"DATABASE_URI"`
+	AccrualSystemAddress string        `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	SecretKey            string        `env:"SECRET_KEY"`
+	SessionLifetime      time.Duration `env:"SESSION_LIFETIME" envDefault:"1h"`
+	SessionIdleTimeout   time.Duration `env:"SESSION_IDLE_TIMEOUT" envDefault:"30m"`
+	PasswordResetTTL     time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"15m"`
+	ContactCodeTTL       time.Duration `env:"CONTACT_CODE_TTL" envDefault:"10m"`
+	ContactCodeCooldown  time.Duration `env:"CONTACT_CODE_COOLDOWN" envDefault:"1m"`
+	ContactCodeDaily     int           `env:"CONTACT_CODE_DAILY" envDefault:"10"`
+	NotifierFile         string        `env:"NOTIFIER_FILE"`
+	LoginAttempts        int           `env:"LOGIN_ATTEMPTS" envDefault:"5"`
+	LoginIPAttempts      int           `env:"LOGIN_IP_ATTEMPTS" envDefault:"20"`
+	LoginLockout         time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	AdminLogins          []string      `env:"ADMIN_LOGINS" envSeparator:","`
+	TOTPIssuer           string        `env:"TOTP_ISSUER" envDefault:"Gophermart"`
+	LoginMinLength       int           `env:"LOGIN_MIN_LENGTH" envDefault:"3"`
+	LoginMaxLength       int           `env:"LOGIN_MAX_LENGTH" envDefault:"64"`
+	PasswordMinLength    int           `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordClasses      int           `env:"PASSWORD_CLASSES" envDefault:"1"`
+	ReservedLogins       []string      `env:"RESERVED_LOGINS" envDefault:"admin,administrator,root,support,system" envSeparator:","`
+	OIDCIssuer           string        `env:"OIDC_ISSUER"`
+	OIDCClientID         string        `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret     string        `env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL      string        `env:"OIDC_REDIRECT_URL"`
+	OIDCScopes           []string      `env:"OIDC_SCOPES" envDefault:"openid,profile,email" envSeparator:","`
+	OrderBatchSize       int           `env:"ORDER_BATCH_SIZE" envDefault:"1000"`
+	OrderValidators      []string      `env:"ORDER_VALIDATORS" envSeparator:","`
 }
 
 func GetConfig() (Config, error) {
@@ -24,11 +55,84 @@ func GetConfig() (Config, error) {
 	flag.StringVar(&C.RunAddress, "a", C.RunAddress, "run address")
 	flag.StringVar(&C.DataBaseURI, "d", C.DataBaseURI, "database uri")
 	flag.StringVar(&C.AccrualSystemAddress, "r", C.AccrualSystemAddress, "accrual system address")
+	flag.StringVar(&C.SecretKey, "k", C.SecretKey, "session token secret key")
+	flag.DurationVar(&C.SessionLifetime, "s", C.SessionLifetime, "absolute session lifetime")
+	flag.DurationVar(&C.SessionIdleTimeout, "session-idle", C.SessionIdleTimeout, "session idle timeout")
+	flag.DurationVar(&C.PasswordResetTTL, "reset-ttl", C.PasswordResetTTL, "password reset token lifetime")
+	flag.DurationVar(&C.ContactCodeTTL, "contact-code-ttl", C.ContactCodeTTL, "email/phone verification code lifetime")
+	flag.DurationVar(&C.ContactCodeCooldown, "contact-code-cooldown", C.ContactCodeCooldown, "min interval between verification codes")
+	flag.IntVar(&C.ContactCodeDaily, "contact-code-daily", C.ContactCodeDaily, "verification codes per contact per day")
+	flag.StringVar(&C.NotifierFile, "n", C.NotifierFile, "file for notifications (password reset and contact verification off if empty)")
+	flag.IntVar(&C.LoginAttempts, "login-attempts", C.LoginAttempts, "failed logins per account before delays")
+	flag.IntVar(&C.LoginIPAttempts, "login-ip-attempts", C.LoginIPAttempts, "failed logins per ip before delays")
+	flag.DurationVar(&C.LoginLockout, "login-lockout", C.LoginLockout, "max login lockout")
+	flag.Func("admins", "comma-separated logins granted the admin role on start", func(s string) error {
+		C.AdminLogins = strings.Split(s, ",")
+		return nil
+	})
+	flag.StringVar(&C.TOTPIssuer, "totp-issuer", C.TOTPIssuer, "issuer shown in authenticator apps")
+	flag.IntVar(&C.LoginMinLength, "login-min", C.LoginMinLength, "min login length")
+	flag.IntVar(&C.LoginMaxLength, "login-max", C.LoginMaxLength, "max login length")
+	flag.IntVar(&C.PasswordMinLength, "password-min", C.PasswordMinLength, "min password length")
+	flag.IntVar(&C.PasswordClasses, "password-classes", C.PasswordClasses,
+		"required character classes in password (lower, upper, digits, other)")
+	flag.StringVar(&C.OIDCIssuer, "oidc-issuer", C.OIDCIssuer, "openid connect issuer url (sso login off if empty)")
+	flag.StringVar(&C.OIDCClientID, "oidc-client-id", C.OIDCClientID, "openid connect client id")
+	flag.StringVar(&C.OIDCClientSecret, "oidc-client-secret", C.OIDCClientSecret, "openid connect client secret")
+	flag.StringVar(&C.OIDCRedirectURL, "oidc-redirect-url", C.OIDCRedirectURL, "openid connect callback url")
+	flag.IntVar(&C.OrderBatchSize, "order-batch", C.OrderBatchSize, "max order numbers in one batch upload")
+	flag.Func("order-validators", "comma-separated prefix=scheme order number checks (luhn, mod11; * for default)",
+		func(s string) error {
+			C.OrderValidators = strings.Split(s, ",")
+			return nil
+		})
 	flag.Parse()
 
 	if C.RunAddress == "" || C.AccrualSystemAddress == "" || C.DataBaseURI == "" {
 		return Config{}, errors.New("error config")
 	}
 
+	if C.LoginAttempts < 1 || C.LoginIPAttempts < 1 {
+		return Config{}, errors.New("error config: login attempts")
+	}
+
+	// Классов символов четыре: строчные, заглавные, цифры и остальные.
+	if C.LoginMinLength < 1 || C.LoginMaxLength < C.LoginMinLength || C.PasswordMinLength < 1 ||
+		C.PasswordClasses < 1 || C.PasswordClasses > 4 {
+		return Config{}, errors.New("error config: credentials policy")
+	}
+
+	if C.OrderBatchSize < 1 {
+		return Config{}, errors.New("error config: order batch size")
+	}
+
+	if C.OIDCIssuer != "" && (C.OIDCClientID == "" || C.OIDCRedirectURL == "") {
+		return Config{}, errors.New("error config: oidc")
+	}
+
+	// Провайдер OIDC доступен только по https.
+	if u, err := url.Parse(C.OIDCIssuer); C.OIDCIssuer != "" && (err != nil || u.Scheme != "https" || u.Host == "") {
+		return Config{}, errors.New("error config: oidc issuer must be https")
+	}
+
+	if C.SessionLifetime <= 0 || C.SessionIdleTimeout <= 0 || C.PasswordResetTTL <= 0 || C.ContactCodeTTL <= 0 || C.LoginLockout <= 0 {
+		return Config{}, errors.New("error config: lifetime")
+	}
+
+	if C.ContactCodeCooldown < 0 || C.ContactCodeDaily < 1 {
+		return Config{}, errors.New("error config: contact code limits")
+	}
+
+	if C.SecretKey == "" {
+		// Без ключа токены подписываются случайным ключом и перестают быть действительными после перезапуска.
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return Config{}, err
+		}
+
+		C.SecretKey = hex.EncodeToString(key)
+		log.Print("secret key is not set, sessions will not survive a restart")
+	}
+
 	return C, nil
 }
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+// AccountExport - полный архив данных пользователя для выгрузки по запросу субъекта данных.
+type AccountExport struct {
+	User             User              `json:"user"`
+	Profile          Profile           `json:"profile"`
+	TwoFactorEnabled bool              `json:"two_factor_enabled"`
+	Orders           []Order           `json:"orders"`
+	OrderHistory     []OrderTransition `json:"order_history"`
+	Adjustments      []Adjustment      `json:"order_adjustments"`
+	WithDrawals      []WithDraw        `json:"withdrawals"`
+	Sessions         []Session         `json:"sessions"`
+	APIKeys          []APIKey          `json:"api_keys"`
+	Identities       []Identity        `json:"identities"`
+	SecurityEvents   []SecurityEvent   `json:"security_events"`
+	ExportedAt       string            `json:"exported_at"`
+}
+
+var (
+	// Удаление учетной записи: строка users сохраняется под обезличенным логином вместе с заказами
+	// и списаниями, которые нужны для финансовой отчетности; все остальные данные удаляются.
+	dbGetLoginByID  = `SELECT login FROM users WHERE userid = $1 AND deleted_at IS NULL`
+	dbAnonymizeUser = `UPDATE users SET login = $1, password = '', role = 'user', totp_secret = NULL, totp_enabled = false,
+								email = NULL, email_verified = false, phone = NULL, phone_verified = false,
+								deleted_at = now() WHERE userid = $2`
+	dbAnonymizeOrders   = `UPDATE orders SET login = $1 WHERE login = $2`
+	dbAnonymizeWithDraw = `UPDATE withdraw SET login = $1 WHERE login = $2`
+	dbDellUserAPIKeys   = `DELETE FROM api_keys WHERE userid = $1`
+	dbDellUserResets    = `DELETE FROM password_resets WHERE userid = $1`
+)
+
+// Export собирает все данные пользователя.
+func (db *DataBase) Export(userID string) (AccountExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var login string
+	if err := db.DB.QueryRowContext(ctx, dbGetLoginByID, userID).Scan(&login); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return AccountExport{}, err
+		}
+
+		return AccountExport{}, ErrNotFound
+	}
+
+	user, err := db.GetBalance(login)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	user.UserID = userID
+
+	export := AccountExport{User: user, ExportedAt: time.Now().Format(time.RFC3339)}
+
+	if export.Profile, err = db.GetProfile(userID); err != nil {
+		return AccountExport{}, err
+	}
+
+	if _, export.TwoFactorEnabled, err = db.GetTOTP(userID); err != nil {
+		return AccountExport{}, err
+	}
+
+	if export.Orders, err = db.GetOrders(login); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.OrderHistory, err = db.GetUserOrderHistory(login); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.Adjustments, err = db.GetUserAdjustments(login); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.WithDrawals, err = db.GetWithDraw(login); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.Sessions, err = db.GetSessions(userID); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.APIKeys, err = db.GetAPIKeys(userID); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.Identities, err = db.GetIdentities(userID); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	if export.SecurityEvents, err = db.GetSecurityEvents(userID, math.MaxInt32); err != nil && !errors.Is(err, ErrEmpty) {
+		return AccountExport{}, err
+	}
+
+	return export, nil
+}
+
+// DeleteUser после проверки пароля обезличивает учетную запись и удаляет все ее данные,
+// кроме финансовых записей. Неверный пароль дает ErrWrongData, аккаунт без пароля удаляется
+// только при recent (недавний вход), иначе ErrReauthRequired.
+func (db *DataBase) DeleteUser(userID, pass string, recent bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var login string
+	if err := db.DB.QueryRowContext(ctx, dbGetLoginByID, userID).Scan(&login); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		return ErrNotFound
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var password string
+	if err := db.DB.QueryRowContext(ctx, dbGetPassword, userID).Scan(&password); err != nil {
+		return err
+	}
+
+	if err := checkCurrentPassword(password, pass, recent); err != nil {
+		return err
+	}
+
+	anonymous := "deleted-" + userID
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, q := range []struct {
+		query string
+		args  []any
+	}{
+		{dbAnonymizeOrders, []any{anonymous, login}},
+		{dbAnonymizeWithDraw, []any{anonymous, login}},
+		{dbAnonymizeSecurityEvents, []any{anonymous, userID, login}},
+		{dbAnonymizeUser, []any{anonymous, userID}},
+		{dbDellUserSessions, []any{userID}},
+		{dbDellUserAPIKeys, []any{userID}},
+		{dbDellRecoveryCodes, []any{userID}},
+		{dbDellUserResets, []any{userID}},
+		{dbDellIdentities, []any{userID}},
+		{dbDellContactCodes, []any{userID}},
+		{dbDellLoginFailure, []any{"login:" + login}},
+	} {
+		if _, err = tx.ExecContext(ctx, q.query, q.args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Adjustment - корректировка начисления по уже обработанному заказу (возврат, чарджбэк, доначисление).
+type Adjustment struct {
+	ID        string  `json:"id"`
+	Number    string  `json:"order"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason"`
+	CreatedBy string  `json:"created_by"`
+	CreatedAt string  `json:"created_at"`
+}
+
+var (
+	// Корректировки начислений order_adjustments. Владелец определяется через заказ, поэтому корректировки
+	// учитываются в балансе и после обезличивания учетной записи.
+	dbAddAdjustment = `INSERT INTO order_adjustments (number, amount, reason, created_by)
+							SELECT number, $2, $3, $4 FROM orders WHERE number = $1 AND status = $5
+							RETURNING id, created_at`
+	dbGetAdjustments = `SELECT id, amount, reason, created_by, created_at FROM order_adjustments
+							WHERE number = $1 ORDER BY id`
+	dbGetUserAdjustments = `SELECT a.id, a.number, a.amount, a.reason, a.created_by, a.created_at FROM order_adjustments a
+							JOIN orders o ON o.number = a.number WHERE o.login = $1 ORDER BY a.id`
+)
+
+// AddAdjustment записывает корректировку начисления по заказу. Корректировать можно только заказ
+// в статусе PROCESSED: для неизвестного заказа возвращается ErrNotFound, для остальных - ErrNotProcessed.
+func (db *DataBase) AddAdjustment(number string, amount float64, reason, createdBy string) (Adjustment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	a := Adjustment{Number: number, Amount: amount, Reason: reason, CreatedBy: createdBy}
+
+	var created time.Time
+	if err := db.DB.QueryRowContext(ctx, dbAddAdjustment, number, amount, reason, createdBy, StatusProcessed).
+		Scan(&a.ID, &created); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Adjustment{}, err
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var login string
+		if err = db.DB.QueryRowContext(ctx, dbGetOrderLogin, number).Scan(&login); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return Adjustment{}, err
+			}
+
+			return Adjustment{}, ErrNotFound
+		}
+
+		return Adjustment{}, ErrNotProcessed
+	}
+
+	a.CreatedAt = created.Format(time.RFC3339)
+
+	return a, nil
+}
+
+// GetAdjustments возвращает корректировки заказа от старых к новым.
+func (db *DataBase) GetAdjustments(number string) ([]Adjustment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetAdjustments, number)
+	if err != nil {
+		return nil, err
+	}
+
+	var adjustments []Adjustment
+	for rows.Next() {
+		var created time.Time
+		a := Adjustment{Number: number}
+		if err = rows.Scan(&a.ID, &a.Amount, &a.Reason, &a.CreatedBy, &created); err != nil {
+			return nil, err
+		}
+
+		a.CreatedAt = created.Format(time.RFC3339)
+		adjustments = append(adjustments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if adjustments == nil {
+		return nil, ErrEmpty
+	}
+
+	return adjustments, nil
+}
+
+// GetUserAdjustments возвращает корректировки по всем заказам пользователя от старых к новым.
+func (db *DataBase) GetUserAdjustments(login string) ([]Adjustment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetUserAdjustments, login)
+	if err != nil {
+		return nil, err
+	}
+
+	var adjustments []Adjustment
+	for rows.Next() {
+		var created time.Time
+		var a Adjustment
+		if err = rows.Scan(&a.ID, &a.Number, &a.Amount, &a.Reason, &a.CreatedBy, &created); err != nil {
+			return nil, err
+		}
+
+		a.CreatedAt = created.Format(time.RFC3339)
+		adjustments = append(adjustments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if adjustments == nil {
+		return nil, ErrEmpty
+	}
+
+	return adjustments, nil
+}
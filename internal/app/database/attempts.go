@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// Таблица неудачных попыток входа login_attempts (ключи вида login:<логин> и ip:<адрес>):
+	dbGetLockout = `SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - now()), 0) FROM login_attempts
+						WHERE key = ANY($1) AND locked_until > now()`
+	// Если с последней ошибки прошло больше максимальной блокировки ($2 секунд), счет начинается заново:
+	// редкие ошибки за долгое время не должны копиться до блокировки.
+	dbAddLoginFailure = `INSERT INTO login_attempts (key, failures, last_failure) VALUES ($1, 1, now())
+							ON CONFLICT(key) DO UPDATE SET last_failure = now(),
+							failures = CASE WHEN login_attempts.last_failure <= now() - $2 * interval '1 second'
+								THEN 1 ELSE login_attempts.failures + 1 END
+							RETURNING failures`
+	dbSetLockout       = `UPDATE login_attempts SET locked_until = now() + $1 * interval '1 second' WHERE key = $2`
+	dbDellLoginFailure = `DELETE FROM login_attempts WHERE key = $1`
+	// Снятие блокировки учетной записи снимает и блокировки адресов, с которых в ее логин недавно не входили.
+	dbDellLockout = `DELETE FROM login_attempts WHERE key = 'login:' || $1
+							OR key IN (SELECT 'ip:' || ip FROM security_events WHERE login = $1 AND event = $2
+								AND created_at > now() - $3 * interval '1 second')`
+)
+
+// lockoutDelay возвращает время, на которое блокируются попытки входа после failures неудачных подряд:
+// первые free попыток не ограничиваются, затем задержка удваивается с каждой ошибкой вплоть до max.
+func lockoutDelay(failures, free int, max time.Duration) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	n := failures - free
+	if n > 30 {
+		return max
+	}
+
+	delay := time.Second << n
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
+
+// GetLockout возвращает, сколько еще действует блокировка по любому из ключей.
+func (db *DataBase) GetLockout(keys ...string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var seconds float64
+	if err := db.DB.QueryRowContext(ctx, dbGetLockout, pq.Array(keys)).Scan(&seconds); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// AddLoginFailure учитывает неудачную попытку входа и при необходимости блокирует ключ. Счетчик
+// сбрасывается, если предыдущая ошибка была раньше, чем max назад.
+func (db *DataBase) AddLoginFailure(key string, free int, max time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var failures int
+	if err := db.DB.QueryRowContext(ctx, dbAddLoginFailure, key, max.Seconds()).Scan(&failures); err != nil {
+		return err
+	}
+
+	delay := lockoutDelay(failures, free, max)
+	if delay == 0 {
+		return nil
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbSetLockout, delay.Seconds(), key)
+	return err
+}
+
+// ResetLoginFailures снимает блокировку и обнуляет счетчик неудачных попыток по ключу.
+func (db *DataBase) ResetLoginFailures(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbDellLoginFailure, key)
+	return err
+}
+
+// ClearLockout снимает блокировку входа с логина и с адресов, с которых за последние window были
+// неудачные попытки входа в него.
+func (db *DataBase) ClearLockout(login string, window time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbDellLockout, login, EventLoginFailure, window.Seconds())
+	return err
+}
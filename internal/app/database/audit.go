@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// События журнала безопасности.
+const (
+	EventRegister              = "register"
+	EventLoginSuccess          = "login_success"
+	EventLoginFailure          = "login_failure"
+	EventLogout                = "logout"
+	EventPasswordChange        = "password_change"
+	EventPasswordChangeFailure = "password_change_failure"
+	EventPasswordReset         = "password_reset"
+	EventSessionRevoke         = "session_revoke"
+	EventLockoutClear          = "lockout_clear"
+)
+
+type SecurityEvent struct {
+	UserID    string `json:"-"`
+	Login     string `json:"-"`
+	Event     string `json:"event"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Details   string `json:"details,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+var (
+	// Журнал безопасности security_events. Таблица только пополняется: правила в схеме отменяют DELETE
+	// и любой UPDATE, кроме обезличивания при удалении учетной записи, поэтому записи переживают удаление
+	// без логина и сетевых данных пользователя.
+	// Если userid неизвестен (неудачный вход), он определяется по логину.
+	dbAddSecurityEvent = `INSERT INTO security_events (userid, login, event, ip, user_agent, details)
+							VALUES (COALESCE(NULLIF($1, '')::integer,
+								(SELECT userid FROM users WHERE login = $2 AND deleted_at IS NULL)), $2, $3, $4, $5, $6)`
+	dbAnonymizeSecurityEvents = `UPDATE security_events SET login = $1, ip = '', user_agent = '', details = ''
+								WHERE userid = $2 OR (userid IS NULL AND login = $3)`
+	dbGetSecurityEvents = `SELECT event, ip, user_agent, details, created_at FROM security_events
+							WHERE userid = $1 ORDER BY id DESC LIMIT $2`
+)
+
+// AddSecurityEvent записывает событие в журнал безопасности.
+func (db *DataBase) AddSecurityEvent(e SecurityEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbAddSecurityEvent, e.UserID, e.Login, e.Event, e.IP, e.UserAgent, e.Details)
+	return err
+}
+
+// GetSecurityEvents возвращает последние limit событий пользователя, новые первыми.
+func (db *DataBase) GetSecurityEvents(userID string, limit int) ([]SecurityEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetSecurityEvents, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []SecurityEvent
+	for rows.Next() {
+		var created time.Time
+		e := SecurityEvent{UserID: userID}
+		if err = rows.Scan(&e.Event, &e.IP, &e.UserAgent, &e.Details, &created); err != nil {
+			return nil, err
+		}
+
+		e.CreatedAt = created.Format(time.RFC3339)
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if events == nil {
+		return nil, ErrEmpty
+	}
+
+	return events, nil
+}
@@ -9,28 +9,42 @@ import (
 	"time"
 
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/ordernumber"
 	_ "github.com/lib/pq"
 )
 
 type DataBase struct {
 	DB *sql.DB
+
+	// validator проверяет номера загружаемых заказов и заказов, в счет которых списываются баллы.
+	validator ordernumber.Validator
 }
 
 var (
 	ErrUsed             = errors.New("used")
 	ErrEmpty            = errors.New("empty")
+	ErrNotFound         = errors.New("not found")
 	ErrNoMoney          = errors.New("no money")
 	ErrDuplicate        = errors.New("duplicate")
 	ErrWrongData        = errors.New("wrong data")
 	ErrBadOrderNumber   = errors.New("bad order number")
 	ErrRegisterConflict = errors.New("register conflict")
+	// ErrIllegalTransition - заказ уже в статусе, из которого запрошенный переход недопустим.
+	ErrIllegalTransition = errors.New("illegal order status transition")
+	// ErrNotProcessed - заказ еще не получил итоговое начисление и не может быть скорректирован.
+	ErrNotProcessed = errors.New("order is not processed")
+	// ErrReauthRequired - у аккаунта нет пароля, подтвердить действие можно только повторным входом.
+	ErrReauthRequired = errors.New("reauthentication required")
+	// ErrRateLimited - новый код подтверждения запрошен раньше, чем позволяют ограничения.
+	ErrRateLimited = errors.New("rate limited")
 )
 
+// orders.uploaded_at хранится строкой RFC3339 со смещением, поэтому ее приведение к timestamptz не зависит
+// от настроек сессии, и order_uploaded_at можно объявить IMMUTABLE для индекса страниц заказов.
 var dbCreateTables = `CREATE TABLE IF NOT EXISTS users (
 							userid			SERIAL  PRIMARY KEY NOT NULL,
 							login			VARCHAR UNIQUE		NOT NULL,
-							password		VARCHAR 			NOT NULL,
-							cookie			VARCHAR UNIQUE		NULL);
+							password		VARCHAR 			NOT NULL);
 	
 					CREATE TABLE IF NOT EXISTS orders (
 							number 			VARCHAR PRIMARY KEY NOT NULL,
@@ -38,12 +52,124 @@ var dbCreateTables = `CREATE TABLE IF NOT EXISTS users (
 							status 			VARCHAR 			NOT NULL	DEFAULT 'NEW',
 							accrual 		NUMERIC 			NULL,
 							uploaded_at 	VARCHAR				NOT NULL);
+
+					CREATE OR REPLACE FUNCTION order_uploaded_at(v VARCHAR) RETURNS TIMESTAMPTZ
+							AS $$ SELECT v::timestamptz $$ LANGUAGE sql IMMUTABLE;
+					CREATE INDEX IF NOT EXISTS orders_login_uploaded_at ON orders (login, order_uploaded_at(uploaded_at), number);
 	
 					CREATE TABLE IF NOT EXISTS withdraw (
 							orderID 		VARCHAR PRIMARY KEY NOT NULL,
 							login 			VARCHAR 			NOT NULL,
 							sum 			NUMERIC 			NOT NULL,
-							processed_at	VARCHAR 			NOT NULL);`
+							processed_at	VARCHAR 			NOT NULL);
+
+					CREATE TABLE IF NOT EXISTS sessions (
+							id 				VARCHAR PRIMARY KEY NOT NULL,
+							userid 			INTEGER 			NOT NULL,
+							user_agent 		VARCHAR 			NOT NULL,
+							ip 				VARCHAR 			NOT NULL,
+							created_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now(),
+							last_seen 		TIMESTAMPTZ 		NOT NULL	DEFAULT now(),
+							expires_at 		TIMESTAMPTZ 		NOT NULL);
+
+					CREATE TABLE IF NOT EXISTS password_resets (
+							token_hash 		VARCHAR PRIMARY KEY NOT NULL,
+							userid 			INTEGER 			NOT NULL,
+							expires_at 		TIMESTAMPTZ 		NOT NULL,
+							used 			BOOLEAN 			NOT NULL	DEFAULT false);
+
+					CREATE TABLE IF NOT EXISTS login_attempts (
+							key 			VARCHAR PRIMARY KEY NOT NULL,
+							failures 		INTEGER 			NOT NULL	DEFAULT 0,
+							locked_until 	TIMESTAMPTZ 		NULL,
+							last_failure 	TIMESTAMPTZ 		NOT NULL	DEFAULT now());
+
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret 	VARCHAR NULL;
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false;
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NULL;
+					ALTER TABLE sessions ADD COLUMN IF NOT EXISTS mfa 		BOOLEAN NOT NULL DEFAULT false;
+					ALTER TABLE sessions ADD COLUMN IF NOT EXISTS idle_timeout INTERVAL NOT NULL DEFAULT '30 minutes';
+
+					CREATE TABLE IF NOT EXISTS recovery_codes (
+							userid 			INTEGER 			NOT NULL,
+							code_hash 		VARCHAR 			NOT NULL,
+							used 			BOOLEAN 			NOT NULL	DEFAULT false,
+							PRIMARY KEY (userid, code_hash));
+
+					CREATE TABLE IF NOT EXISTS api_keys (
+							id 				VARCHAR PRIMARY KEY NOT NULL,
+							userid 			INTEGER 			NOT NULL,
+							name 			VARCHAR 			NOT NULL,
+							key_hash 		VARCHAR UNIQUE 		NOT NULL,
+							scopes 			VARCHAR[] 			NOT NULL,
+							created_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now(),
+							last_used 		TIMESTAMPTZ 		NULL);
+
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at 	TIMESTAMPTZ NULL;
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS role 		VARCHAR NOT NULL DEFAULT 'user';
+
+					CREATE TABLE IF NOT EXISTS user_identities (
+							issuer 			VARCHAR 			NOT NULL,
+							subject 		VARCHAR 			NOT NULL,
+							userid 			INTEGER 			NOT NULL,
+							created_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now(),
+							PRIMARY KEY (issuer, subject));
+
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS email 			VARCHAR NULL;
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified 	BOOLEAN NOT NULL DEFAULT false;
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS phone 			VARCHAR NULL;
+					ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified 	BOOLEAN NOT NULL DEFAULT false;
+
+					CREATE TABLE IF NOT EXISTS contact_codes (
+							userid 			INTEGER 			NOT NULL,
+							channel 		VARCHAR 			NOT NULL,
+							target 			VARCHAR 			NOT NULL,
+							code_hash 		VARCHAR 			NOT NULL,
+							expires_at 		TIMESTAMPTZ 		NOT NULL,
+							attempts 		INTEGER 			NOT NULL	DEFAULT 0,
+							issued_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now(),
+							issued_count 	INTEGER 			NOT NULL	DEFAULT 1,
+							window_start 	TIMESTAMPTZ 		NOT NULL	DEFAULT now(),
+							PRIMARY KEY (userid, channel));
+
+					CREATE TABLE IF NOT EXISTS security_events (
+							id 				BIGSERIAL PRIMARY KEY NOT NULL,
+							userid 			INTEGER 			NULL,
+							login 			VARCHAR 			NOT NULL,
+							event 			VARCHAR 			NOT NULL,
+							ip 				VARCHAR 			NOT NULL,
+							user_agent 		VARCHAR 			NOT NULL,
+							details 		VARCHAR 			NOT NULL	DEFAULT '',
+							created_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now());
+
+					CREATE INDEX IF NOT EXISTS security_events_userid ON security_events (userid, id);
+					CREATE OR REPLACE RULE security_events_no_update AS ON UPDATE TO security_events
+							WHERE NOT (NEW.login LIKE 'deleted-%' AND NEW.ip = '' AND NEW.user_agent = '' AND NEW.details = ''
+								AND NEW.id = OLD.id AND NEW.userid IS NOT DISTINCT FROM OLD.userid
+								AND NEW.event = OLD.event AND NEW.created_at = OLD.created_at)
+							DO INSTEAD NOTHING;
+					CREATE OR REPLACE RULE security_events_no_delete AS ON DELETE TO security_events DO INSTEAD NOTHING;
+
+					ALTER TABLE orders ADD COLUMN IF NOT EXISTS checked_at 	TIMESTAMPTZ NULL;
+
+					CREATE TABLE IF NOT EXISTS order_history (
+							id 				BIGSERIAL PRIMARY KEY NOT NULL,
+							number 			VARCHAR 			NOT NULL,
+							status 			VARCHAR 			NOT NULL,
+							accrual 		NUMERIC 			NULL,
+							changed_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now());
+
+					CREATE INDEX IF NOT EXISTS order_history_number ON order_history (number, id);
+
+					CREATE TABLE IF NOT EXISTS order_adjustments (
+							id 				BIGSERIAL PRIMARY KEY NOT NULL,
+							number 			VARCHAR 			NOT NULL,
+							amount 			NUMERIC 			NOT NULL,
+							reason 			VARCHAR 			NOT NULL,
+							created_by 		VARCHAR 			NOT NULL,
+							created_at 		TIMESTAMPTZ 		NOT NULL	DEFAULT now());
+
+					CREATE INDEX IF NOT EXISTS order_adjustments_number ON order_adjustments (number, id);`
 
 func StartDB(c config.Config) (*DataBase, error) {
 	db, err := sql.Open("postgres", c.DataBaseURI)
@@ -67,5 +193,16 @@ func StartDB(c config.Config) (*DataBase, error) {
 		return nil, err
 	}
 
-	return &DataBase{DB: db}, nil
+	validator, err := ordernumber.New(c.OrderValidators)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DataBase{DB: db, validator: validator}
+
+	if err = d.bootstrapAdmins(c.AdminLogins); err != nil {
+		return nil, err
+	}
+
+	return d, nil
 }
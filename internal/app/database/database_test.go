@@ -0,0 +1,18 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// dropTables удаляет схему вместе со всеми таблицами и функциями после теста,
+// чтобы следующий тест начинал с пустой базы.
+func dropTables(db *DataBase) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := db.DB.ExecContext(ctx, `DROP SCHEMA public CASCADE; CREATE SCHEMA public;`); err != nil {
+		log.Print(err)
+	}
+}
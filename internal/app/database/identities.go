@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Identity - учетная запись внешнего провайдера (OIDC), привязанная к пользователю.
+type Identity struct {
+	Issuer    string `json:"issuer"`
+	Subject   string `json:"subject"`
+	CreatedAt string `json:"created_at"`
+}
+
+var (
+	// Таблица привязанных внешних учетных записей user_identities:
+	dbGetIdentityUser = `SELECT users.userid, users.login FROM user_identities JOIN users ON users.userid = user_identities.userid
+							WHERE user_identities.issuer = $1 AND user_identities.subject = $2 AND users.deleted_at IS NULL`
+	dbAddIdentity = `INSERT INTO user_identities (issuer, subject, userid) VALUES ($1, $2, $3)
+							ON CONFLICT (issuer, subject) DO NOTHING`
+	dbGetIdentities    = `SELECT issuer, subject, created_at FROM user_identities WHERE userid = $1 ORDER BY created_at`
+	dbDellIdentities   = `DELETE FROM user_identities WHERE userid = $1`
+	dbRegisterNoPass   = `INSERT INTO users (login, password) VALUES ($1, '') ON CONFLICT(login) DO NOTHING RETURNING userid`
+	dbGetIdentityOwner = `SELECT userid FROM user_identities WHERE issuer = $1 AND subject = $2`
+)
+
+// ExternalLogin находит пользователя, привязанного к внешней учетной записи, а при первом входе
+// создает для нее пользователя без пароля. Если логин занят, к нему добавляется случайный суффикс:
+// совпадение логинов не дает доступа к чужой учетной записи. Логин с суффиксом не длиннее maxLen:
+// при необходимости исходный логин обрезается.
+func (db *DataBase) ExternalLogin(issuer, subject, login string, maxLen int) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var userID, userLogin string
+	err = tx.QueryRowContext(ctx, dbGetIdentityUser, issuer, subject).Scan(&userID, &userLogin)
+	if err == nil {
+		return userID, userLogin, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", err
+	}
+
+	userLogin = login
+	for i := 0; ; i++ {
+		err = tx.QueryRowContext(ctx, dbRegisterNoPass, userLogin).Scan(&userID)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) || i == 3 {
+			return "", "", err
+		}
+
+		suffix, err := randomHex(3)
+		if err != nil {
+			return "", "", err
+		}
+
+		base := []rune(login)
+		if n := maxLen - len(suffix) - 1; len(base) > n && n > 0 {
+			base = base[:n]
+		}
+
+		userLogin = string(base) + "-" + suffix
+	}
+
+	exec, err := tx.ExecContext(ctx, dbAddIdentity, issuer, subject, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Параллельный первый вход уже привязал эту учетную запись к другому пользователю.
+	if affected == 0 {
+		return "", "", ErrUsed
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return userID, userLogin, nil
+}
+
+// LinkIdentity привязывает внешнюю учетную запись к пользователю. Если она уже привязана
+// к другому пользователю, возвращается ErrUsed.
+func (db *DataBase) LinkIdentity(userID, issuer, subject string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := db.DB.ExecContext(ctx, dbAddIdentity, issuer, subject, userID); err != nil {
+		return err
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var owner string
+	if err := db.DB.QueryRowContext(ctx, dbGetIdentityOwner, issuer, subject).Scan(&owner); err != nil {
+		return err
+	}
+
+	if owner != userID {
+		return ErrUsed
+	}
+
+	return nil
+}
+
+func (db *DataBase) GetIdentities(userID string) ([]Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []Identity
+	for rows.Next() {
+		var created time.Time
+		var i Identity
+		if err = rows.Scan(&i.Issuer, &i.Subject, &created); err != nil {
+			return nil, err
+		}
+
+		i.CreatedAt = created.Format(time.RFC3339)
+		identities = append(identities, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if identities == nil {
+		return nil, ErrEmpty
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix отличает персональные API-ключи от токенов сессий.
+const APIKeyPrefix = "gm_"
+
+type APIKey struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"-"`
+	Login     string   `json:"-"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Key       string   `json:"key,omitempty"` // возвращается только при создании
+	CreatedAt string   `json:"created_at"`
+	LastUsed  string   `json:"last_used,omitempty"`
+	Verified  bool     `json:"-"`
+}
+
+var (
+	// Таблица персональных API-ключей api_keys:
+	dbAddAPIKey = `INSERT INTO api_keys (id, userid, name, key_hash, scopes) VALUES ($1, $2, $3, $4, $5)
+						RETURNING created_at`
+	dbGetAPIKeys = `SELECT id, name, scopes, created_at, last_used FROM api_keys WHERE userid = $1 ORDER BY created_at`
+	dbDellAPIKey = `DELETE FROM api_keys WHERE userid = $1 AND id = $2`
+	dbCheckKey   = `UPDATE api_keys SET last_used = now() FROM users
+						WHERE api_keys.key_hash = $1 AND users.userid = api_keys.userid
+						RETURNING api_keys.id, api_keys.userid, users.login, api_keys.scopes, NOT users.totp_enabled`
+)
+
+// AddAPIKey создает ключ с заданными правами. Сам ключ возвращается один раз, в базе хранится его хеш.
+func (db *DataBase) AddAPIKey(userID, name string, scopes []string) (APIKey, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	key := APIKey{ID: id, UserID: userID, Name: name, Scopes: scopes, Key: APIKeyPrefix + secret}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var created time.Time
+	if err = db.DB.QueryRowContext(ctx, dbAddAPIKey, id, userID, name, hashToken(key.Key), pq.Array(scopes)).
+		Scan(&created); err != nil {
+		return APIKey{}, err
+	}
+
+	key.CreatedAt = created.Format(time.RFC3339)
+
+	return key, nil
+}
+
+func (db *DataBase) GetAPIKeys(userID string) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetAPIKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	for rows.Next() {
+		var created time.Time
+		var lastUsed sql.NullTime
+		key := APIKey{UserID: userID}
+		if err = rows.Scan(&key.ID, &key.Name, pq.Array(&key.Scopes), &created, &lastUsed); err != nil {
+			return nil, err
+		}
+
+		key.CreatedAt = created.Format(time.RFC3339)
+		if lastUsed.Valid {
+			key.LastUsed = lastUsed.Time.Format(time.RFC3339)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if keys == nil {
+		return nil, ErrEmpty
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey отзывает ключ пользователя. Чужие и несуществующие ключи дают ErrNotFound.
+func (db *DataBase) DeleteAPIKey(userID, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbDellAPIKey, userID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CheckAPIKey находит владельца ключа и отмечает время последнего использования.
+func (db *DataBase) CheckAPIKey(key string) (APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var k APIKey
+	if err := db.DB.QueryRowContext(ctx, dbCheckKey, hashToken(key)).
+		Scan(&k.ID, &k.UserID, &k.Login, pq.Array(&k.Scopes), &k.Verified); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return APIKey{}, err
+		}
+
+		return APIKey{}, ErrNotFound
+	}
+
+	return k, nil
+}
@@ -2,50 +2,111 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"log"
-	"strconv"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Order struct {
-	Number     string  `json:"number"`
-	Login      string  `json:"login,omitempty"`
-	Status     string  `json:"status"`
-	Accrual    float64 `json:"accrual,omitempty"`
-	UploadedAt string  `json:"uploaded_at,omitempty"`
+	Number     string      `json:"number"`
+	Login      string      `json:"login,omitempty"`
+	Status     OrderStatus `json:"status"`
+	Accrual    float64     `json:"accrual,omitempty"`
+	UploadedAt string      `json:"uploaded_at,omitempty"`
+	CheckedAt  string      `json:"checked_at,omitempty"`
+	Adjustment float64     `json:"adjustment,omitempty"` // сумма корректировок начисления
 }
 
-var (
-	// Таблица заказов orders:
-	dbAddOrder            = `INSERT INTO orders (number, login, uploaded_at) VALUES ($1, $2, $3) ON CONFLICT(number) DO NOTHING`
-	dbGetOrders           = `SELECT number, status, COALESCE(accrual, 0), uploaded_at FROM orders WHERE login = $1`
-	dbGetNotCheckedOrders = `SELECT number FROM orders WHERE status = 'NEW' OR status = 'PROCESSING'`
-	dbUpdateOrder         = `UPDATE orders SET status = $1, accrual = $2 WHERE number = $3`
-	dbGetOrderLogin       = `SELECT login FROM orders WHERE number = $1`
+// Результаты загрузки отдельных номеров в пакете.
+const (
+	OrderAccepted  = "accepted"  // номер принят в обработку
+	OrderDuplicate = "duplicate" // номер уже загружен этим пользователем
+	OrderUsed      = "conflict"  // номер загружен другим пользователем
+	OrderInvalid   = "invalid"   // номер не прошел проверку
 )
 
-var sumOfElementsOfADoubleNumber = [...]int{0, 2, 4, 6, 8, 1, 3, 5, 7, 9}
+type OrderTransition struct {
+	Number    string      `json:"order,omitempty"` // заполняется только в выгрузке по всем заказам
+	Status    OrderStatus `json:"status"`
+	Accrual   float64     `json:"accrual,omitempty"`
+	ChangedAt string      `json:"changed_at"`
+}
 
-func checkOrderNumber(number int) bool {
-	s := strconv.Itoa(number)
-	odd := len(s) & 1
-	var sum int
-	for i, c := range s {
-		if c < '0' || c > '9' {
-			return false
-		}
-		if i&1 == odd {
-			sum += sumOfElementsOfADoubleNumber[c-'0']
-		} else {
-			sum += int(c - '0')
-		}
-	}
-	return sum%10 == 0
+type OrderResult struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
+
+// OrderCursor указывает на последний заказ страницы; следующая страница начинается сразу после него.
+type OrderCursor struct {
+	UploadedAt time.Time
+	Number     string
+}
+
+// OrderFilter - условия выборки страницы заказов. Нулевые значения полей не ограничивают выборку.
+type OrderFilter struct {
+	Statuses []string
+	From     time.Time // загружены не раньше
+	To       time.Time // загружены раньше
+	Desc     bool      // сначала новые
+	After    *OrderCursor
+	Limit    int // 0 - без ограничения
 }
 
-func (db *DataBase) AddOrder(login string, order int) error {
-	if !checkOrderNumber(order) {
+var (
+	// Таблица заказов orders:
+	dbAddOrder = `WITH o AS (INSERT INTO orders (number, login, uploaded_at) VALUES ($1, $2, $3)
+								ON CONFLICT(number) DO NOTHING RETURNING number)
+							INSERT INTO order_history (number, status) SELECT number, 'NEW' FROM o`
+	dbGetOrders = `SELECT number, status, COALESCE(accrual, 0), uploaded_at FROM orders WHERE login = $1
+								ORDER BY order_uploaded_at(uploaded_at), number`
+	dbGetNotCheckedOrders = `SELECT number FROM orders WHERE status = 'NEW' OR status = 'PROCESSING'`
+	dbUpdateOrder         = `WITH o AS (UPDATE orders SET status = $1, accrual = $2
+								WHERE number = $3 AND status = ANY($4::varchar[]) RETURNING number)
+							INSERT INTO order_history (number, status, accrual) SELECT number, $1, $2 FROM o`
+	dbGetOrderLogin  = `SELECT login FROM orders WHERE number = $1`
+	dbGetOrderStatus = `SELECT status FROM orders WHERE number = $1`
+	dbGetOrder       = `SELECT number, status, COALESCE(accrual, 0), uploaded_at, checked_at,
+								COALESCE((SELECT SUM(amount) FROM order_adjustments a WHERE a.number = orders.number), 0)
+								FROM orders WHERE number = $1 AND login = $2`
+	dbTouchOrder = `UPDATE orders SET checked_at = now() WHERE number = $1`
+	dbAddOrders  = `WITH o AS (INSERT INTO orders (number, login, uploaded_at) SELECT unnest($1::varchar[]), $2, $3
+								ON CONFLICT(number) DO NOTHING RETURNING number),
+							h AS (INSERT INTO order_history (number, status) SELECT number, 'NEW' FROM o)
+							SELECT number FROM o`
+	dbGetOrdersLogin = `SELECT number, login FROM orders WHERE number = ANY($1::varchar[])`
+
+	// История статусов order_history: загрузка и каждое обновление заказа добавляют запись
+	// в том же запросе, что и изменение самого заказа.
+	dbGetOrderHistory = `SELECT h.status, COALESCE(h.accrual, 0), h.changed_at FROM order_history h
+							JOIN orders o ON o.number = h.number WHERE h.number = $1 AND o.login = $2 ORDER BY h.id`
+	dbGetUserOrderHistory = `SELECT h.number, h.status, COALESCE(h.accrual, 0), h.changed_at FROM order_history h
+							JOIN orders o ON o.number = h.number WHERE o.login = $1 ORDER BY h.id`
+
+	// Страница заказов по ключу (uploaded_at, number) для каждого направления сортировки.
+	// uploaded_at хранится строкой RFC3339 и сравнивается через order_uploaded_at, как в индексе
+	// orders_login_uploaded_at, чтобы страница читалась по индексу без сортировки всех заказов.
+	dbGetOrdersPage = map[bool]string{
+		false: `SELECT number, status, COALESCE(accrual, 0), uploaded_at FROM orders
+					WHERE login = $1 AND (COALESCE(cardinality($2::varchar[]), 0) = 0 OR status = ANY($2::varchar[]))
+					AND ($3::timestamptz IS NULL OR order_uploaded_at(uploaded_at) >= $3)
+					AND ($4::timestamptz IS NULL OR order_uploaded_at(uploaded_at) < $4)
+					AND ($5::timestamptz IS NULL OR (order_uploaded_at(uploaded_at), number) > ($5, $6::varchar))
+					ORDER BY order_uploaded_at(uploaded_at), number LIMIT $7`,
+		true: `SELECT number, status, COALESCE(accrual, 0), uploaded_at FROM orders
+					WHERE login = $1 AND (COALESCE(cardinality($2::varchar[]), 0) = 0 OR status = ANY($2::varchar[]))
+					AND ($3::timestamptz IS NULL OR order_uploaded_at(uploaded_at) >= $3)
+					AND ($4::timestamptz IS NULL OR order_uploaded_at(uploaded_at) < $4)
+					AND ($5::timestamptz IS NULL OR (order_uploaded_at(uploaded_at), number) < ($5, $6::varchar))
+					ORDER BY order_uploaded_at(uploaded_at) DESC, number DESC LIMIT $7`,
+	}
+)
+
+func (db *DataBase) AddOrder(login, order string) error {
+	if !db.validator.Valid(order) {
 		return ErrBadOrderNumber
 	}
 
@@ -81,6 +142,96 @@ func (db *DataBase) AddOrder(login string, order int) error {
 	return ErrDuplicate
 }
 
+// AddOrders загружает пакет номеров одной транзакцией и возвращает результат для каждого номера в порядке
+// запроса. Повтор номера внутри пакета считается дубликатом.
+func (db *DataBase) AddOrders(login string, numbers []string) ([]OrderResult, error) {
+	results := make([]OrderResult, len(numbers))
+	var valid []string
+	for i, number := range numbers {
+		results[i].Number = number
+		if !db.validator.Valid(number) {
+			results[i].Result = OrderInvalid
+			continue
+		}
+
+		valid = append(valid, number)
+	}
+
+	if valid == nil {
+		return results, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.QueryContext(ctx, dbAddOrders, pq.Array(valid), login, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := map[string]bool{}
+	for rows.Next() {
+		var number string
+		if err = rows.Scan(&number); err != nil {
+			return nil, err
+		}
+
+		accepted[number] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, dbGetOrdersLogin, pq.Array(valid))
+	if err != nil {
+		return nil, err
+	}
+
+	owners := map[string]string{}
+	for rows.Next() {
+		var number, owner string
+		if err = rows.Scan(&number, &owner); err != nil {
+			return nil, err
+		}
+
+		owners[number] = owner
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		number := results[i].Number
+		switch {
+		case results[i].Result != "":
+		case accepted[number]:
+			results[i].Result = OrderAccepted
+			delete(accepted, number)
+		case owners[number] != login:
+			results[i].Result = OrderUsed
+		default:
+			results[i].Result = OrderDuplicate
+		}
+	}
+
+	return results, nil
+}
+
 func (db *DataBase) GetNotCheckedOrders() ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -110,11 +261,30 @@ func (db *DataBase) GetNotCheckedOrders() ([]string, error) {
 	return orders, nil
 }
 
-func (db *DataBase) UpdateOrder(number, status string, accrual float64) error {
+// GetOrderStatus возвращает текущий статус заказа.
+func (db *DataBase) GetOrderStatus(number string) (OrderStatus, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	exec, err := db.DB.ExecContext(ctx, dbUpdateOrder, status, accrual, number)
+	var status OrderStatus
+	if err := db.DB.QueryRowContext(ctx, dbGetOrderStatus, number).Scan(&status); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+
+		return "", ErrNotFound
+	}
+
+	return status, nil
+}
+
+// UpdateOrder переводит заказ в новый статус. Переход проверяется в самом запросе UPDATE, поэтому
+// запоздавшее обновление не откатит итоговый статус: в этом случае возвращается ErrIllegalTransition.
+func (db *DataBase) UpdateOrder(number string, status OrderStatus, accrual float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbUpdateOrder, status, accrual, number, pq.Array(status.sources()))
 	if err != nil {
 		return err
 	}
@@ -125,7 +295,17 @@ func (db *DataBase) UpdateOrder(number, status string, accrual float64) error {
 	}
 
 	if affected == 0 {
-		return errors.New("failed update order")
+		current, err := db.GetOrderStatus(number)
+		if err != nil {
+			return err
+		}
+
+		// Повтор уже записанного статуса (например, после перезапуска worker) ничего не меняет и ошибкой не считается.
+		if current == status {
+			return nil
+		}
+
+		return ErrIllegalTransition
 	}
 
 	log.Printf("update order: number: %s, status: %s, accrual: %g", number, status, accrual)
@@ -133,6 +313,76 @@ func (db *DataBase) UpdateOrder(number, status string, accrual float64) error {
 	return nil
 }
 
+// GetOrder возвращает заказ пользователя. Чужой заказ не отличается от несуществующего: оба дают ErrNotFound.
+func (db *DataBase) GetOrder(login, number string) (Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var order Order
+	var checked sql.NullTime
+	if err := db.DB.QueryRowContext(ctx, dbGetOrder, number, login).
+		Scan(&order.Number, &order.Status, &order.Accrual, &order.UploadedAt, &checked, &order.Adjustment); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Order{}, err
+		}
+
+		return Order{}, ErrNotFound
+	}
+
+	if checked.Valid {
+		order.CheckedAt = checked.Time.Format(time.RFC3339)
+	}
+
+	return order, nil
+}
+
+// TouchOrder отмечает время последнего ответа системы расчета по заказу.
+func (db *DataBase) TouchOrder(number string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbTouchOrder, number)
+	return err
+}
+
+// GetOrderHistory возвращает переходы статуса заказа пользователя от старых к новым.
+// Для заказов, загруженных до появления истории, возвращается ErrEmpty.
+func (db *DataBase) GetOrderHistory(login, number string) ([]OrderTransition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetOrderHistory, number, login)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []OrderTransition
+	for rows.Next() {
+		var changed time.Time
+		var transition OrderTransition
+		if err = rows.Scan(&transition.Status, &transition.Accrual, &changed); err != nil {
+			return nil, err
+		}
+
+		transition.ChangedAt = changed.Format(time.RFC3339)
+		history = append(history, transition)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if history != nil {
+		return history, nil
+	}
+
+	if _, err = db.GetOrder(login, number); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrEmpty
+}
+
 func (db *DataBase) GetOrders(login string) ([]Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -162,3 +412,100 @@ func (db *DataBase) GetOrders(login string) ([]Order, error) {
 
 	return orders, nil
 }
+
+// GetOrdersPage возвращает страницу заказов пользователя и курсор следующей страницы (nil, если страница последняя).
+func (db *DataBase) GetOrdersPage(login string, f OrderFilter) ([]Order, *OrderCursor, error) {
+	var after, afterNumber any
+	if f.After != nil {
+		after, afterNumber = f.After.UploadedAt, f.After.Number
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Лишняя строка показывает, есть ли следующая страница. LIMIT NULL возвращает все строки.
+	var limit any
+	if f.Limit > 0 {
+		limit = f.Limit + 1
+	}
+
+	rows, err := db.DB.QueryContext(ctx, dbGetOrdersPage[f.Desc], login, pq.Array(f.Statuses),
+		nullTime(f.From), nullTime(f.To), after, afterNumber, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		if err = rows.Scan(&order.Number, &order.Status, &order.Accrual, &order.UploadedAt); err != nil {
+			return nil, nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if orders == nil {
+		return nil, nil, ErrEmpty
+	}
+
+	if f.Limit == 0 || len(orders) <= f.Limit {
+		return orders, nil, nil
+	}
+
+	orders = orders[:f.Limit]
+	last := orders[len(orders)-1]
+
+	uploadedAt, err := time.Parse(time.RFC3339, last.UploadedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return orders, &OrderCursor{UploadedAt: uploadedAt, Number: last.Number}, nil
+}
+
+// nullTime передает нулевое время в запрос как NULL.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
+// GetUserOrderHistory возвращает историю статусов всех заказов пользователя от старых записей к новым.
+func (db *DataBase) GetUserOrderHistory(login string) ([]OrderTransition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetUserOrderHistory, login)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []OrderTransition
+	for rows.Next() {
+		var changed time.Time
+		var transition OrderTransition
+		if err = rows.Scan(&transition.Number, &transition.Status, &transition.Accrual, &changed); err != nil {
+			return nil, err
+		}
+
+		transition.ChangedAt = changed.Format(time.RFC3339)
+		history = append(history, transition)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if history == nil {
+		return nil, ErrEmpty
+	}
+
+	return history, nil
+}
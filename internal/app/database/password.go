@@ -0,0 +1,72 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hashPassword возвращает bcrypt-хеш пароля для хранения в users.password.
+func hashPassword(pass string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// checkPassword сверяет пароль с сохраненным значением. Значения, которые не являются
+// bcrypt-хешем, считаются паролями, сохраненными открытым текстом до перехода на хеширование:
+// для них legacy = true, и вызывающая сторона должна перехешировать пароль.
+// Пустое сохраненное значение (удаленная учетная запись) не совпадает ни с каким паролем.
+func checkPassword(stored, pass string) (ok, legacy bool) {
+	if stored == "" {
+		return false, false
+	}
+
+	if _, err := bcrypt.Cost([]byte(stored)); err != nil {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1, true
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(pass)) == nil, false
+}
+
+// checkCurrentPassword подтверждает личность перед опасным действием (смена пароля, удаление
+// учетной записи). У аккаунтов, созданных через внешний вход, пароля нет: для них вместо пароля
+// требуется недавний вход (recent), иначе возвращается ErrReauthRequired.
+func checkCurrentPassword(stored, pass string, recent bool) error {
+	if stored == "" {
+		if recent {
+			return nil
+		}
+
+		return ErrReauthRequired
+	}
+
+	if ok, _ := checkPassword(stored, pass); !ok {
+		return ErrWrongData
+	}
+
+	return nil
+}
+
+// randomHex возвращает size случайных байт в hex: идентификаторы сессий, токены, ключи.
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken возвращает хеш случайного токена для хранения в базе. Токены высокоэнтропийные,
+// поэтому медленный KDF, как для паролей, им не нужен.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Способы связи с пользователем, которые подтверждаются кодом.
+const (
+	ChannelEmail = "email"
+	ChannelPhone = "phone"
+)
+
+// maxContactCodeAttempts - сколько раз за сутки можно ввести код подтверждения контакта. Повторная
+// выдача кода не восстанавливает попытки, иначе перебор продолжался бы с каждым новым кодом.
+const maxContactCodeAttempts = 5
+
+type Profile struct {
+	Login         string `json:"login"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Phone         string `json:"phone"`
+	PhoneVerified bool   `json:"phone_verified"`
+}
+
+var (
+	// Контакты пользователя в таблице users и коды их подтверждения в таблице contact_codes:
+	dbGetProfile = `SELECT login, COALESCE(email, ''), email_verified, COALESCE(phone, ''), phone_verified
+						FROM users WHERE userid = $1 AND deleted_at IS NULL`
+	// Новый код выдается не чаще раза в $6 секунд и не больше $7 раз за сутки. Счетчики выдачи и попыток
+	// сбрасываются только со сменой суточного окна.
+	dbAddContactCode = `INSERT INTO contact_codes (userid, channel, target, code_hash, expires_at) VALUES ($1, $2, $3, $4, $5)
+						ON CONFLICT (userid, channel) DO UPDATE SET target = EXCLUDED.target, code_hash = EXCLUDED.code_hash,
+						expires_at = EXCLUDED.expires_at, issued_at = now(),
+						issued_count = CASE WHEN contact_codes.window_start <= now() - interval '1 day'
+							THEN 1 ELSE contact_codes.issued_count + 1 END,
+						attempts = CASE WHEN contact_codes.window_start <= now() - interval '1 day'
+							THEN 0 ELSE contact_codes.attempts END,
+						window_start = CASE WHEN contact_codes.window_start <= now() - interval '1 day'
+							THEN now() ELSE contact_codes.window_start END
+						WHERE contact_codes.issued_at <= now() - $6 * interval '1 second'
+						AND (contact_codes.window_start <= now() - interval '1 day' OR contact_codes.issued_count < $7)
+						RETURNING userid`
+	dbGetContactCodeDelay = `SELECT COALESCE(MAX(EXTRACT(EPOCH FROM GREATEST(issued_at + $3 * interval '1 second',
+							CASE WHEN issued_count >= $4 THEN window_start + interval '1 day' ELSE now() END) - now())), 0)
+						FROM contact_codes WHERE userid = $1 AND channel = $2`
+	dbExpireContactCode = `UPDATE contact_codes SET expires_at = now() WHERE userid = $1 AND channel = $2`
+	dbUseContactCode    = `UPDATE contact_codes SET attempts = attempts + 1
+						WHERE userid = $1 AND channel = $2 AND expires_at > now() AND attempts < $3 RETURNING target, code_hash`
+	dbDellContactCode  = `DELETE FROM contact_codes WHERE userid = $1 AND channel = $2`
+	dbDellContactCodes = `DELETE FROM contact_codes WHERE userid = $1`
+
+	// Смена контакта снимает отметку о подтверждении, только если значение действительно изменилось.
+	dbSetContact = map[string]string{
+		ChannelEmail: `UPDATE users SET email = NULLIF($1, ''), email_verified = false
+						WHERE userid = $2 AND email IS DISTINCT FROM NULLIF($1, '')`,
+		ChannelPhone: `UPDATE users SET phone = NULLIF($1, ''), phone_verified = false
+						WHERE userid = $2 AND phone IS DISTINCT FROM NULLIF($1, '')`,
+	}
+	dbVerifyContact = map[string]string{
+		ChannelEmail: `UPDATE users SET email_verified = true WHERE userid = $1 AND email = $2`,
+		ChannelPhone: `UPDATE users SET phone_verified = true WHERE userid = $1 AND phone = $2`,
+	}
+)
+
+func (db *DataBase) GetProfile(userID string) (Profile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var p Profile
+	if err := db.DB.QueryRowContext(ctx, dbGetProfile, userID).
+		Scan(&p.Login, &p.Email, &p.EmailVerified, &p.Phone, &p.PhoneVerified); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Profile{}, err
+		}
+
+		return Profile{}, ErrNotFound
+	}
+
+	return p, nil
+}
+
+// UpdateProfile меняет переданные контакты (nil - не менять, пустая строка - удалить).
+// Измененный контакт снова становится неподтвержденным, а выпущенный для него код перестает действовать.
+func (db *DataBase) UpdateProfile(userID string, contacts map[string]*string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for channel, value := range contacts {
+		query, ok := dbSetContact[channel]
+		if !ok {
+			return ErrWrongData
+		}
+
+		if value == nil {
+			continue
+		}
+
+		exec, err := tx.ExecContext(ctx, query, *value, userID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := exec.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			continue
+		}
+
+		// Код не удаляется, а истекает: удаление обнулило бы ограничения на выдачу кодов.
+		if _, err = tx.ExecContext(ctx, dbExpireContactCode, userID, channel); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddContactCode выпускает код подтверждения контакта и возвращает контакт, на который его нужно отправить.
+// Если контакт не указан, возвращается ErrEmpty, если уже подтвержден - ErrUsed. Если с прошлого кода
+// не прошло cooldown или за сутки выдано daily кодов, возвращается ErrRateLimited.
+func (db *DataBase) AddContactCode(userID, channel string, ttl, cooldown time.Duration, daily int) (string, string, error) {
+	p, err := db.GetProfile(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	var target string
+	var verified bool
+	switch channel {
+	case ChannelEmail:
+		target, verified = p.Email, p.EmailVerified
+	case ChannelPhone:
+		target, verified = p.Phone, p.PhoneVerified
+	default:
+		return "", "", ErrWrongData
+	}
+
+	if target == "" {
+		return "", "", ErrEmpty
+	}
+
+	if verified {
+		return "", "", ErrUsed
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", "", err
+	}
+
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var id string
+	if err = db.DB.QueryRowContext(ctx, dbAddContactCode, userID, channel, target, hashToken(userID+":"+code),
+		time.Now().Add(ttl), cooldown.Seconds(), daily).Scan(&id); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", "", err
+		}
+
+		return "", "", ErrRateLimited
+	}
+
+	return target, code, nil
+}
+
+// GetContactCodeDelay возвращает, через сколько можно запросить новый код подтверждения контакта.
+func (db *DataBase) GetContactCodeDelay(userID, channel string, cooldown time.Duration, daily int) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var seconds float64
+	if err := db.DB.QueryRowContext(ctx, dbGetContactCodeDelay, userID, channel, cooldown.Seconds(), daily).
+		Scan(&seconds); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ConfirmContact проверяет код и отмечает контакт подтвержденным. Неверный, истекший или исчерпавший
+// попытки код, а также код для уже измененного контакта дают ErrWrongData.
+func (db *DataBase) ConfirmContact(userID, channel, code string) error {
+	query, ok := dbVerifyContact[channel]
+	if !ok {
+		return ErrWrongData
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var target, hash string
+	if err := db.DB.QueryRowContext(ctx, dbUseContactCode, userID, channel, maxContactCodeAttempts).
+		Scan(&target, &hash); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		return ErrWrongData
+	}
+
+	// Код короткий, поэтому в хеш добавлен идентификатор пользователя: одинаковые коды разных пользователей
+	// дают разные хеши.
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(userID+":"+code))) != 1 {
+		return ErrWrongData
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	exec, err := tx.ExecContext(ctx, query, userID, target)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrWrongData
+	}
+
+	if _, err = tx.ExecContext(ctx, dbDellContactCode, userID, channel); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
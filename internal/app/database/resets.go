@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// Таблица токенов сброса пароля password_resets:
+	// Токен отправляется только на подтвержденный контакт: email, если он подтвержден, иначе телефон.
+	dbGetResetContact = `SELECT userid, CASE WHEN email_verified THEN COALESCE(email, '')
+							WHEN phone_verified THEN COALESCE(phone, '') ELSE '' END
+							FROM users WHERE login = $1 AND deleted_at IS NULL`
+	dbAddPasswordReset = `INSERT INTO password_resets (token_hash, userid, expires_at) VALUES ($1, $2, $3)`
+	dbGetPasswordReset = `SELECT users.userid, users.login FROM password_resets JOIN users ON users.userid = password_resets.userid
+							WHERE token_hash = $1 AND NOT used AND expires_at > now()`
+	dbUsePasswordReset = `UPDATE password_resets SET used = true
+							WHERE token_hash = $1 AND NOT used AND expires_at > now() RETURNING userid`
+	dbDellUserSessions = `DELETE FROM sessions WHERE userid = $1`
+)
+
+// AddPasswordReset выпускает одноразовый токен сброса пароля и возвращает его вместе с подтвержденным
+// контактом, на который токен нужно отправить. В базе хранится только хеш токена. Для неизвестного логина
+// возвращается ErrNotFound, для пользователя без подтвержденного контакта - ErrEmpty.
+func (db *DataBase) AddPasswordReset(login string, ttl time.Duration) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var userID, target string
+	if err := db.DB.QueryRowContext(ctx, dbGetResetContact, login).Scan(&userID, &target); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", "", err
+		}
+
+		return "", "", ErrNotFound
+	}
+
+	if target == "" {
+		return "", "", ErrEmpty
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err = db.DB.ExecContext(ctx, dbAddPasswordReset, hashToken(token), userID, time.Now().Add(ttl)); err != nil {
+		return "", "", err
+	}
+
+	return token, target, nil
+}
+
+// GetPasswordReset возвращает идентификатор и логин владельца действующего токена сброса пароля.
+func (db *DataBase) GetPasswordReset(token string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var userID, login string
+	if err := db.DB.QueryRowContext(ctx, dbGetPasswordReset, hashToken(token)).Scan(&userID, &login); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", "", err
+		}
+
+		return "", "", ErrWrongData
+	}
+
+	return userID, login, nil
+}
+
+// ResetPassword гасит токен, устанавливает новый пароль и завершает все сессии пользователя.
+func (db *DataBase) ResetPassword(token, pass string) error {
+	hash, err := hashPassword(pass)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var userID string
+	if err = tx.QueryRowContext(ctx, dbUsePasswordReset, hashToken(token)).Scan(&userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		return ErrWrongData
+	}
+
+	if _, err = tx.ExecContext(ctx, dbSetPassword, hash, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, dbDellUserSessions, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
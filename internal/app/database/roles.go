@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Роли пользователей: support снимает блокировки входа, admin дополнительно назначает роли.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var roles = map[string]bool{RoleUser: true, RoleSupport: true, RoleAdmin: true}
+
+var (
+	// Роль пользователя в таблице users:
+	dbSetRole      = `UPDATE users SET role = $1 WHERE login = $2 AND deleted_at IS NULL`
+	dbGrantAdmins  = `UPDATE users SET role = 'admin' WHERE login = ANY($1) AND deleted_at IS NULL RETURNING login`
+	dbGetRoleUsers = `SELECT login FROM users WHERE role = $1 AND deleted_at IS NULL ORDER BY login`
+)
+
+// ValidRole сообщает, существует ли роль.
+func ValidRole(role string) bool {
+	return roles[role]
+}
+
+// SetRole назначает роль пользователю. Неизвестная роль дает ErrWrongData, неизвестный логин - ErrNotFound.
+func (db *DataBase) SetRole(login, role string) error {
+	if !ValidRole(role) {
+		return ErrWrongData
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbSetRole, role, login)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetRoleUsers возвращает логины пользователей с заданной ролью.
+func (db *DataBase) GetRoleUsers(role string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetRoleUsers, role)
+	if err != nil {
+		return nil, err
+	}
+
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err = rows.Scan(&login); err != nil {
+			return nil, err
+		}
+
+		logins = append(logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if logins == nil {
+		return nil, ErrEmpty
+	}
+
+	return logins, nil
+}
+
+// bootstrapAdmins выдает роль admin учетным записям из конфигурации. Так назначается первый
+// администратор: остальные роли он раздает уже через API.
+func (db *DataBase) bootstrapAdmins(logins []string) error {
+	if len(logins) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGrantAdmins, pq.Array(logins))
+	if err != nil {
+		return err
+	}
+
+	granted := map[string]bool{}
+	for rows.Next() {
+		var login string
+		if err = rows.Scan(&login); err != nil {
+			return err
+		}
+
+		granted[login] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, login := range logins {
+		if !granted[login] {
+			log.Printf("bootstrap admins: user %s not found", login)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Session struct {
+	ID        string `json:"id"`
+	UserID    string `json:"-"`
+	Login     string `json:"-"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	CreatedAt string `json:"created_at"`
+	LastSeen  string `json:"last_seen"`
+	ExpiresAt string `json:"expires_at"`
+	IdleUntil string `json:"idle_expires_at"` // сессия истечет раньше expires_at, если до этого времени не будет обращений
+	Current   bool   `json:"current"`
+	Verified  bool   `json:"-"` // сессия прошла 2FA или 2FA у пользователя выключена
+	Role      string `json:"-"`
+}
+
+var (
+	// Таблица сессий sessions:
+	dbDellExpiredSessions = `DELETE FROM sessions WHERE userid = $1 AND (expires_at <= now() OR last_seen + idle_timeout <= now())`
+	dbAddSession          = `INSERT INTO sessions (id, userid, user_agent, ip, expires_at, idle_timeout)
+								VALUES ($1, $2, $3, $4, $5, $6 * interval '1 second')`
+	// last_seen обновляется не чаще раза в минуту, остальные запросы только читают сессию.
+	dbCheckSession = `WITH s AS (
+								SELECT sessions.id, sessions.userid, users.login, sessions.mfa OR NOT users.totp_enabled AS verified,
+									users.role, sessions.created_at, sessions.expires_at, sessions.idle_timeout, sessions.last_seen,
+									sessions.last_seen < now() - interval '1 minute' AS stale
+								FROM sessions JOIN users ON users.userid = sessions.userid
+								WHERE sessions.id = $1 AND sessions.expires_at > now() AND sessions.last_seen + sessions.idle_timeout > now()),
+							touched AS (UPDATE sessions SET last_seen = now() FROM s WHERE sessions.id = s.id AND s.stale)
+							SELECT userid, login, verified, role, created_at, expires_at,
+								LEAST(CASE WHEN stale THEN now() ELSE last_seen END + idle_timeout, expires_at)
+							FROM s`
+	dbGetSessions = `SELECT id, user_agent, ip, created_at, last_seen, expires_at, LEAST(last_seen + idle_timeout, expires_at)
+						FROM sessions WHERE userid = $1 AND expires_at > now() AND last_seen + idle_timeout > now()
+						ORDER BY last_seen DESC`
+	dbDellSession       = `DELETE FROM sessions WHERE userid = $1 AND id = $2`
+	dbDellOtherSessions = `DELETE FROM sessions WHERE userid = $1 AND id <> $2`
+)
+
+// AddSession создает сессию пользователя и возвращает ее идентификатор. Сессия действует до expiresAt,
+// но завершается раньше, если между обращениями проходит больше idle.
+func (db *DataBase) AddSession(userID, userAgent, ip string, expiresAt time.Time, idle time.Duration) (string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err = db.DB.ExecContext(ctx, dbDellExpiredSessions, userID); err != nil {
+		return "", err
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err = db.DB.ExecContext(ctx, dbAddSession, id, userID, userAgent, ip, expiresAt, idle.Seconds()); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// CheckSession проверяет, что сессия существует и не истекла ни по абсолютному сроку, ни по простою,
+// и отмечает время последнего обращения, тем самым продлевая ее.
+func (db *DataBase) CheckSession(id string) (Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var created, expires, idle time.Time
+	session := Session{ID: id}
+	if err := db.DB.QueryRowContext(ctx, dbCheckSession, id).
+		Scan(&session.UserID, &session.Login, &session.Verified, &session.Role, &created, &expires, &idle); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Session{}, err
+		}
+
+		return Session{}, ErrNotFound
+	}
+
+	session.CreatedAt = created.Format(time.RFC3339)
+	session.ExpiresAt = expires.Format(time.RFC3339)
+	session.IdleUntil = idle.Format(time.RFC3339)
+
+	return session, nil
+}
+
+func (db *DataBase) GetSessions(userID string) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, dbGetSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	for rows.Next() {
+		var created, lastSeen, expires, idle time.Time
+		s := Session{UserID: userID}
+		if err = rows.Scan(&s.ID, &s.UserAgent, &s.IP, &created, &lastSeen, &expires, &idle); err != nil {
+			return nil, err
+		}
+
+		s.CreatedAt = created.Format(time.RFC3339)
+		s.LastSeen = lastSeen.Format(time.RFC3339)
+		s.ExpiresAt = expires.Format(time.RFC3339)
+		s.IdleUntil = idle.Format(time.RFC3339)
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if sessions == nil {
+		return nil, ErrEmpty
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession завершает сессию пользователя. Чужие и несуществующие сессии дают ErrNotFound.
+func (db *DataBase) DeleteSession(userID, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbDellSession, userID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteOtherSessions завершает все сессии пользователя, кроме сессии keepID.
+func (db *DataBase) DeleteOtherSessions(userID, keepID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbDellOtherSessions, userID, keepID)
+	return err
+}
@@ -0,0 +1,60 @@
+package database
+
+// OrderStatus - статус обработки заказа системой расчета.
+type OrderStatus string
+
+const (
+	StatusNew        OrderStatus = "NEW"
+	StatusProcessing OrderStatus = "PROCESSING"
+	StatusInvalid    OrderStatus = "INVALID"
+	StatusProcessed  OrderStatus = "PROCESSED"
+)
+
+// OrderStatuses перечисляет все статусы в порядке обработки.
+var OrderStatuses = []OrderStatus{StatusNew, StatusProcessing, StatusInvalid, StatusProcessed}
+
+// orderTransitions - допустимые переходы статуса. Из NEW можно сразу перейти в итоговый статус:
+// система расчета может закончить обработку до первого опроса. INVALID и PROCESSED итоговые и не меняются.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusNew:        {StatusProcessing, StatusInvalid, StatusProcessed},
+	StatusProcessing: {StatusInvalid, StatusProcessed},
+}
+
+// Valid сообщает, существует ли статус.
+func (s OrderStatus) Valid() bool {
+	for _, status := range OrderStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Final сообщает, что статус итоговый.
+func (s OrderStatus) Final() bool {
+	return s.Valid() && len(orderTransitions[s]) == 0
+}
+
+// CanTransition сообщает, может ли заказ перейти из статуса s в статус to.
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, status := range orderTransitions[s] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sources возвращает статусы, из которых допустим переход в статус s.
+func (s OrderStatus) sources() []string {
+	var sources []string
+	for _, from := range OrderStatuses {
+		if from.CanTransition(s) {
+			sources = append(sources, string(from))
+		}
+	}
+
+	return sources
+}
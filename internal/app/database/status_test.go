@@ -0,0 +1,38 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from OrderStatus
+		to   OrderStatus
+		want bool
+	}{
+		{from: StatusNew, to: StatusProcessing, want: true},
+		{from: StatusNew, to: StatusProcessed, want: true},
+		{from: StatusProcessing, to: StatusInvalid, want: true},
+		{from: StatusProcessing, to: StatusNew, want: false},
+		{from: StatusProcessing, to: StatusProcessing, want: false},
+		{from: StatusProcessed, to: StatusProcessing, want: false},
+		{from: StatusInvalid, to: StatusProcessed, want: false},
+		{from: "REGISTERED", to: StatusProcessing, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransition(tt.to); got != tt.want {
+				t.Errorf("CanTransition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !StatusProcessed.Final() || !StatusInvalid.Final() || StatusProcessing.Final() || OrderStatus("DONE").Final() {
+		t.Errorf("Final() reports wrong final statuses")
+	}
+
+	if got, want := StatusProcessed.sources(), []string{"NEW", "PROCESSING"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources() = %v, want %v", got, want)
+	}
+}
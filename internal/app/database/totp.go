@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// Двухфакторная аутентификация: столбцы totp_* таблицы users и таблица recovery_codes:
+	dbSetTOTPSecret = `UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE userid = $2 AND NOT totp_enabled`
+	dbGetTOTP       = `SELECT COALESCE(totp_secret, ''), totp_enabled FROM users WHERE userid = $1`
+	dbEnableTOTP    = `UPDATE users SET totp_enabled = true WHERE userid = $1 AND totp_secret IS NOT NULL`
+	dbDisableTOTP   = `UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = NULL WHERE userid = $1`
+	// Код принимается только для периода позже последнего принятого, поэтому его нельзя использовать повторно.
+	dbUseTOTPStep = `UPDATE users SET totp_last_step = $1
+						WHERE userid = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+	dbDellRecoveryCodes    = `DELETE FROM recovery_codes WHERE userid = $1`
+	dbAddRecoveryCode      = `INSERT INTO recovery_codes (userid, code_hash) VALUES ($1, $2)`
+	dbUseRecoveryCode      = `UPDATE recovery_codes SET used = true WHERE userid = $1 AND code_hash = $2 AND NOT used`
+	dbSetSessionMFA        = `UPDATE sessions SET mfa = true WHERE id = $1`
+	dbResetOtherSessionMFA = `UPDATE sessions SET mfa = false WHERE userid = $1 AND id <> $2`
+)
+
+// SetTOTPSecret сохраняет секрет, ожидающий подтверждения. Если 2FA уже включена, возвращает ErrUsed.
+func (db *DataBase) SetTOTPSecret(userID, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbSetTOTPSecret, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUsed
+	}
+
+	return nil
+}
+
+// GetTOTP возвращает секрет пользователя и признак включенной 2FA.
+func (db *DataBase) GetTOTP(userID string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var secret string
+	var enabled bool
+	if err := db.DB.QueryRowContext(ctx, dbGetTOTP, userID).Scan(&secret, &enabled); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", false, err
+		}
+
+		return "", false, ErrNotFound
+	}
+
+	return secret, enabled, nil
+}
+
+// UseTOTPStep отмечает период принятого кода TOTP. Если код этого или более позднего периода уже
+// принимался, возвращает ErrUsed.
+func (db *DataBase) UseTOTPStep(userID string, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbUseTOTPStep, step, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUsed
+	}
+
+	return nil
+}
+
+// EnableTOTP включает 2FA, заменяет коды восстановления и отмечает текущую сессию как прошедшую 2FA.
+func (db *DataBase) EnableTOTP(userID, sessionID string, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	exec, err := tx.ExecContext(ctx, dbEnableTOTP, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	if _, err = tx.ExecContext(ctx, dbDellRecoveryCodes, userID); err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		if _, err = tx.ExecContext(ctx, dbAddRecoveryCode, userID, hashToken(code)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, dbSetSessionMFA, sessionID); err != nil {
+		return err
+	}
+
+	// Остальные сессии были открыты без второго фактора.
+	if _, err = tx.ExecContext(ctx, dbResetOtherSessionMFA, userID, sessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP выключает 2FA и удаляет коды восстановления.
+func (db *DataBase) DisableTOTP(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, dbDisableTOTP, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, dbDellRecoveryCodes, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode гасит код восстановления. Неизвестный или использованный код дает ErrWrongData.
+func (db *DataBase) UseRecoveryCode(userID, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exec, err := db.DB.ExecContext(ctx, dbUseRecoveryCode, userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrWrongData
+	}
+
+	return nil
+}
+
+// SetSessionMFA отмечает сессию как прошедшую проверку второго фактора.
+func (db *DataBase) SetSessionMFA(sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, dbSetSessionMFA, sessionID)
+	return err
+}
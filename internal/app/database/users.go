@@ -11,99 +11,113 @@ type User struct {
 	UserID   string  `json:"user_id,omitempty"`
 	Login    string  `json:"login,omitempty"`
 	Password string  `json:"password,omitempty"`
-	Cookie   string  `json:"cookie,omitempty"`
-	Current  float64 `json:"current"`   // (сумма из orders) минус (сумма из withdraw)
+	Current  float64 `json:"current"`   // (сумма из orders) плюс (корректировки) минус (сумма из withdraw), может быть отрицательным
 	WithDraw float64 `json:"withdrawn"` // Сумма из withdraw
 }
 
 var (
 	// Таблица пользователей users:
-	dbRegistration  = `INSERT INTO users (login, password, cookie) VALUES ($1, $2, $3) ON CONFLICT(login) DO NOTHING`
-	dbAuthorization = `SELECT COALESCE(cookie, '-') FROM users WHERE login = $1 AND password = $2`
-	dbDellCookie    = `UPDATE users SET cookie = NULL WHERE cookie = $1`
-	dbSetCookie     = `UPDATE users SET cookie = $1 WHERE login = $2 AND password = $3`
-	dbGetLogin      = `SELECT login FROM users WHERE cookie = $1`
+	dbRegistration  = `INSERT INTO users (login, password) VALUES ($1, $2) ON CONFLICT(login) DO NOTHING RETURNING userid`
+	dbAuthorization = `SELECT userid, password FROM users WHERE login = $1 AND deleted_at IS NULL`
+	dbGetPassword   = `SELECT password FROM users WHERE userid = $1`
+	dbSetPassword   = `UPDATE users SET password = $1 WHERE userid = $2`
 	dbGetBalance    = `SELECT login, 
-						COALESCE((SELECT SUM(accrual) FROM orders WHERE login = $1 GROUP BY login), 0) -
+						COALESCE((SELECT SUM(accrual) FROM orders WHERE login = $1 GROUP BY login), 0) +
+						COALESCE((SELECT SUM(a.amount) FROM order_adjustments a JOIN orders o ON o.number = a.number
+							WHERE o.login = $1), 0) -
 						COALESCE((SELECT SUM(sum) FROM withdraw WHERE login = $1 GROUP BY login), 0),
 						COALESCE((SELECT SUM(sum) FROM withdraw WHERE login = $1 GROUP BY login), 0)
 						FROM users WHERE login = $1`
 )
 
-func (db *DataBase) Register(login, pass, cookie string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	if _, err := db.DB.ExecContext(ctx, dbDellCookie, cookie); err != nil {
-		return err
+// Register создает пользователя и возвращает его идентификатор.
+func (db *DataBase) Register(login, pass string) (string, error) {
+	hash, err := hashPassword(pass)
+	if err != nil {
+		return "", err
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	exec, err := db.DB.ExecContext(ctx, dbRegistration, login, pass, cookie)
-	if err != nil {
-		return err
-	}
-
-	affected, err := exec.RowsAffected()
-	if err != nil {
-		return err
-	}
+	var userID string
+	if err = db.DB.QueryRowContext(ctx, dbRegistration, login, hash).Scan(&userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
 
-	if affected == 0 {
-		return ErrRegisterConflict
+		return "", ErrRegisterConflict
 	}
 
-	return nil
+	return userID, nil
 }
 
-func (db *DataBase) Login(login, pass, cookie string) error {
+// Login проверяет пару логин/пароль и возвращает идентификатор пользователя.
+func (db *DataBase) Login(login, pass string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	var cookieDB string
-	if err := db.DB.QueryRowContext(ctx, dbAuthorization, login, pass).Scan(&cookieDB); err != nil {
+	var userID, password string
+	if err := db.DB.QueryRowContext(ctx, dbAuthorization, login).Scan(&userID, &password); err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			return err
+			return "", err
 		}
 
-		return ErrWrongData
+		return "", ErrWrongData
 	}
 
-	if cookieDB != cookie {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
+	ok, legacy := checkPassword(password, pass)
+	if !ok {
+		return "", ErrWrongData
+	}
 
-		if _, err := db.DB.ExecContext(ctx, dbDellCookie, cookie); err != nil {
-			return err
+	if legacy {
+		hash, err := hashPassword(pass)
+		if err != nil {
+			return "", err
 		}
 
 		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 
-		if _, err := db.DB.ExecContext(ctx, dbSetCookie, cookie, login, pass); err != nil {
-			return err
+		if _, err = db.DB.ExecContext(ctx, dbSetPassword, hash, userID); err != nil {
+			return "", err
 		}
 	}
 
-	return nil
+	return userID, nil
 }
 
-func (db *DataBase) Authentication(cookie string) (string, error) {
+// ChangePassword заменяет пароль пользователя после проверки текущего пароля.
+// recent - сессия открыта недавно: так аккаунт без пароля (только внешний вход)
+// может задать пароль, не зная текущего.
+func (db *DataBase) ChangePassword(userID, current, pass string, recent bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	var login string
-	if err := db.DB.QueryRowContext(ctx, dbGetLogin, cookie).Scan(&login); err != nil {
+	var password string
+	if err := db.DB.QueryRowContext(ctx, dbGetPassword, userID).Scan(&password); err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			return "", err
+			return err
 		}
 
-		return "", nil
+		return ErrWrongData
+	}
+
+	if err := checkCurrentPassword(password, current, recent); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(pass)
+	if err != nil {
+		return err
 	}
 
-	return login, nil
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = db.DB.ExecContext(ctx, dbSetPassword, hash, userID)
+	return err
 }
 
 func (db *DataBase) GetBalance(login string) (User, error) {
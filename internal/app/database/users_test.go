@@ -10,9 +10,67 @@ import (
 )
 
 type user struct {
-	login  string
-	pass   string
-	cookie string
+	login string
+	pass  string
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("password")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		stored     string
+		pass       string
+		wantOk     bool
+		wantLegacy bool
+	}{
+		{
+			name:       "Хеш, верный пароль",
+			stored:     hash,
+			pass:       "password",
+			wantOk:     true,
+			wantLegacy: false,
+		},
+		{
+			name:       "Хеш, неверный пароль",
+			stored:     hash,
+			pass:       "password1",
+			wantOk:     false,
+			wantLegacy: false,
+		},
+		{
+			name:       "Открытый текст, верный пароль",
+			stored:     "password",
+			pass:       "password",
+			wantOk:     true,
+			wantLegacy: true,
+		},
+		{
+			name:       "Удаленная учетная запись",
+			stored:     "",
+			pass:       "",
+			wantOk:     false,
+			wantLegacy: false,
+		},
+		{
+			name:       "Открытый текст, неверный пароль",
+			stored:     "password",
+			pass:       "password1",
+			wantOk:     false,
+			wantLegacy: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOk, gotLegacy := checkPassword(tt.stored, tt.pass)
+			if gotOk != tt.wantOk || gotLegacy != tt.wantLegacy {
+				t.Errorf("checkPassword() = %v, %v, want %v, %v", gotOk, gotLegacy, tt.wantOk, tt.wantLegacy)
+			}
+		})
+	}
 }
 
 func TestUsers(t *testing.T) {
@@ -31,16 +89,11 @@ func TestUsers(t *testing.T) {
 
 	login(t, db)
 
-	authentication(t, db)
+	legacyLogin(t, db)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+	changePassword(t, db)
 
-	_, err = db.DB.ExecContext(ctx, `DROP TABLE users, orders, withdraw;`)
-	if err != nil {
-		log.Print(err)
-		return
-	}
+	dropTables(db)
 }
 
 func register(t *testing.T, db *DataBase) {
@@ -54,45 +107,40 @@ func register(t *testing.T, db *DataBase) {
 		{
 			name: "Пользователь 1",
 			args: user{
-				login:  "username1",
-				pass:   "password",
-				cookie: "0",
+				login: "username1",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
 		{
 			name: "Пользователь 2",
 			args: user{
-				login:  "username2",
-				pass:   "password",
-				cookie: "0",
+				login: "username2",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
 		{
 			name: "Пользователь 3",
 			args: user{
-				login:  "username3",
-				pass:   "password",
-				cookie: "4",
+				login: "username3",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
 		{
 			name: "Пользователь 1",
 			args: user{
-				login:  "username1",
-				pass:   "password1",
-				cookie: "0",
+				login: "username1",
+				pass:  "password1",
 			},
 			wantErr: true,
 		},
 		{
 			name: "Пользователь 5",
 			args: user{
-				login:  "username5",
-				pass:   "password",
-				cookie: "1",
+				login: "username5",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
@@ -100,7 +148,7 @@ func register(t *testing.T, db *DataBase) {
 
 	for _, tt := range tests {
 		t.Run("Register: "+tt.name, func(t *testing.T) {
-			if err := db.Register(tt.args.login, tt.args.pass, tt.args.cookie); (err != nil) != tt.wantErr {
+			if _, err := db.Register(tt.args.login, tt.args.pass); (err != nil) != tt.wantErr {
 				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -118,102 +166,132 @@ func login(t *testing.T, db *DataBase) {
 		{
 			name: "Пользователь 1",
 			args: user{
-				login:  "username1",
-				pass:   "password",
-				cookie: "9",
+				login: "username1",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
 		{
 			name: "Пользователь 1",
 			args: user{
-				login:  "username1",
-				pass:   "password2",
-				cookie: "4",
+				login: "username1",
+				pass:  "password2",
 			},
 			wantErr: true,
 		},
 		{
 			name: "Пользователь 3",
 			args: user{
-				login:  "username3",
-				pass:   "password",
-				cookie: "1",
+				login: "username3",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
 		{
 			name: "Пользователь 1",
 			args: user{
-				login:  "username1",
-				pass:   "password1",
-				cookie: "9",
+				login: "username1",
+				pass:  "password1",
 			},
 			wantErr: true,
 		},
 		{
 			name: "Пользователь 5",
 			args: user{
-				login:  "username5",
-				pass:   "password",
-				cookie: "4",
+				login: "username5",
+				pass:  "password",
 			},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run("Login: "+tt.name, func(t *testing.T) {
-			if err := db.Login(tt.args.login, tt.args.pass, tt.args.cookie); (err != nil) != tt.wantErr {
+			if _, err := db.Login(tt.args.login, tt.args.pass); (err != nil) != tt.wantErr {
 				t.Errorf("Login() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func authentication(t *testing.T, db *DataBase) {
-	log.Print("тест аутентификации")
+func legacyLogin(t *testing.T, db *DataBase) {
+	log.Print("тест перехода на хеширование паролей")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := db.DB.ExecContext(ctx, `INSERT INTO users (login, password) VALUES ('legacy', 'password')`); err != nil {
+		t.Errorf("insert legacy user error = %v", err)
+		return
+	}
+
+	if _, err := db.Login("legacy", "password"); err != nil {
+		t.Errorf("Login() error = %v, wantErr %v", err, false)
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var password string
+	if err := db.DB.QueryRowContext(ctx, `SELECT password FROM users WHERE login = 'legacy'`).Scan(&password); err != nil {
+		t.Errorf("select legacy user error = %v", err)
+		return
+	}
+
+	if ok, legacy := checkPassword(password, "password"); !ok || legacy {
+		t.Errorf("checkPassword() = %v, %v, want %v, %v", ok, legacy, true, false)
+	}
+}
+
+func changePassword(t *testing.T, db *DataBase) {
+	log.Print("тест смены пароля")
+
+	userID, err := db.Login("username3", "password")
+	if err != nil {
+		t.Errorf("Login() error = %v, wantErr %v", err, false)
+		return
+	}
 
 	tests := []struct {
 		name    string
-		cookie  string
-		want    string
+		current string
+		pass    string
+		recent  bool
 		wantErr bool
 	}{
 		{
-			name:    "Пользователь 1",
-			cookie:  "9",
-			want:    "username1",
-			wantErr: false,
-		},
-		{
-			name:    "Пользователь 2",
-			cookie:  "0",
-			want:    "",
-			wantErr: false,
+			name:    "Неверный текущий пароль",
+			current: "password1",
+			pass:    "new password",
+			wantErr: true,
 		},
 		{
-			name:    "Пользователь 3",
-			cookie:  "1",
-			want:    "username3",
-			wantErr: false,
+			name:    "Недавний вход не заменяет пароль",
+			current: "",
+			pass:    "new password",
+			recent:  true,
+			wantErr: true,
 		},
 		{
-			name:    "Пользователь 5",
-			cookie:  "4",
-			want:    "username5",
+			name:    "Верный текущий пароль",
+			current: "password",
+			pass:    "new password",
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
-		t.Run("Authentication: "+tt.name, func(t *testing.T) {
-			got, err := db.Authentication(tt.cookie)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Authentication() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
-				t.Errorf("Authentication() got = %v, want %v", got, tt.want)
+		t.Run("ChangePassword: "+tt.name, func(t *testing.T) {
+			if err := db.ChangePassword(userID, tt.current, tt.pass, tt.recent); (err != nil) != tt.wantErr {
+				t.Errorf("ChangePassword() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
+
+	if _, err = db.Login("username3", "password"); err == nil {
+		t.Errorf("Login() error = %v, wantErr %v", err, true)
+	}
+
+	if _, err = db.Login("username3", "new password"); err != nil {
+		t.Errorf("Login() error = %v, wantErr %v", err, false)
+	}
 }
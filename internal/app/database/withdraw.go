@@ -18,12 +18,19 @@ type WithDraw struct {
 var (
 	// Таблица операций withdraw:
 	dbGetWithDraw = `SELECT orderID, sum, processed_at FROM withdraw WHERE login = $1`
+	// Отрицательный после корректировок баланс не пропускает ни одно списание, пока не будет погашен.
 	dbAddWithDraw = `INSERT INTO withdraw SELECT $1, $2, $3, $4
-						WHERE NOT COALESCE((SELECT SUM(accrual) FROM orders WHERE login = $5 GROUP BY login), 0) -
+						WHERE $3 > 0 AND NOT COALESCE((SELECT SUM(accrual) FROM orders WHERE login = $5 GROUP BY login), 0) +
+						COALESCE((SELECT SUM(a.amount) FROM order_adjustments a JOIN orders o ON o.number = a.number
+							WHERE o.login = $5), 0) -
 						COALESCE((SELECT SUM(sum) FROM withdraw WHERE login = $5 GROUP BY login), 0) - $3 < 0`
 )
 
 func (db *DataBase) AddWithDraw(login, order string, sum float64) error {
+	if !db.validator.Valid(order) {
+		return ErrBadOrderNumber
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"context"
 	"log"
 	"reflect"
 	"testing"
@@ -23,13 +22,13 @@ func TestWithDraw(t *testing.T) {
 	}()
 
 	t.Run("Регистрация", func(t *testing.T) {
-		if err := db.Register("username", "password", "0124"); (err != nil) != false {
+		if _, err := db.Register("username", "password"); (err != nil) != false {
 			t.Errorf("Register() error = %v, wantErr %v", err, false)
 		}
 	})
 
 	t.Run("Пополнение баланса", func(t *testing.T) {
-		if err := db.AddOrder("username", 49927398716); (err != nil) != false {
+		if err := db.AddOrder("username", "49927398716"); (err != nil) != false {
 			t.Errorf("AddOrder() error = %v, wantErr %v", err, false)
 		}
 	})
@@ -56,14 +55,7 @@ func TestWithDraw(t *testing.T) {
 		}
 	})
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	_, err = db.DB.ExecContext(ctx, `DROP TABLE users, orders, withdraw;`)
-	if err != nil {
-		log.Print(err)
-		return
-	}
+	dropTables(db)
 }
 
 func addWithDraw(t *testing.T, db *DataBase) {
@@ -81,7 +73,7 @@ func addWithDraw(t *testing.T, db *DataBase) {
 			name: "",
 			args: args{
 				login: "username",
-				order: "1735735",
+				order: "1735737",
 				sum:   161,
 			},
 			wantErr: false,
@@ -108,7 +100,7 @@ func getWithDraw(t *testing.T, db *DataBase) {
 			login: "username",
 			want: []WithDraw{
 				{
-					OrderID:     "1735735",
+					OrderID:     "1735737",
 					Sum:         161,
 					ProcessedAt: time.Now().Format(time.RFC3339),
 				},
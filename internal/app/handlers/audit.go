@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+)
+
+// audit записывает событие в журнал безопасности. Ошибка записи не прерывает обработку запроса.
+func (c *Controller) audit(r *http.Request, event, userID, login, details string) {
+	err := c.db.AddSecurityEvent(database.SecurityEvent{
+		UserID:    userID,
+		Login:     login,
+		Event:     event,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("audit: %s, event: %s, login: %s", err.Error(), event, login)
+	}
+}
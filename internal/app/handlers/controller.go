@@ -3,15 +3,19 @@ package handlers
 import (
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/notifier"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/oidc"
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/worker"
 )
 
 type Controller struct {
-	c      config.Config
-	db     *database.DataBase
-	worker chan worker.OrderStr
+	c        config.Config
+	db       *database.DataBase
+	worker   chan worker.OrderStr
+	notifier notifier.Notifier
+	oidc     *oidc.Provider
 }
 
-func NewController(c config.Config, db *database.DataBase, w chan worker.OrderStr) *Controller {
-	return &Controller{c: c, db: db, worker: w}
+func NewController(c config.Config, db *database.DataBase, w chan worker.OrderStr, n notifier.Notifier) *Controller {
+	return &Controller{c: c, db: db, worker: w, notifier: n, oidc: oidc.NewProvider(c)}
 }
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/go-chi/chi/v5"
+)
+
+func (c *Controller) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("DeleteSession: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	err = c.db.DeleteSession(cookie.ID, id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("DeleteSession: %d, cookie: %s, session: %s", http.StatusNotFound, cookie, id)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Printf("DeleteSession: %s, cookie: %s, session: %s", err.Error(), cookie, id)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, database.EventSessionRevoke, cookie.ID, cookie.Login, "session: "+id)
+
+	if id == cookie.SessionID {
+		c.setSessionCookies(w, "", "", time.Time{})
+	}
+
+	log.Printf("DeleteSession: %d, cookie: %s, session: %s", http.StatusOK, cookie, id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) DeleteLockout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("DeleteLockout: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	login := chi.URLParam(r, "login")
+
+	// Адреса ищутся в журнале за срок, в течение которого неудачные попытки еще учитываются.
+	if err = c.db.ClearLockout(login, c.c.LoginLockout); err != nil {
+		log.Printf("DeleteLockout: %s, cookie: %s, login: %s", err.Error(), cookie, login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, database.EventLockoutClear, "", login, "by: "+cookie.Login)
+	log.Printf("DeleteLockout: %d, cookie: %s, login: %s", http.StatusOK, cookie, login)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) DeleteTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("DeleteTwoFactor: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = c.db.DisableTOTP(cookie.ID); err != nil {
+		log.Printf("DeleteTwoFactor: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("DeleteTwoFactor: %d, cookie: %s", http.StatusOK, cookie)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("DeleteAPIKey: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	err = c.db.DeleteAPIKey(cookie.ID, id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("DeleteAPIKey: %d, cookie: %s, key: %s", http.StatusNotFound, cookie, id)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Printf("DeleteAPIKey: %s, cookie: %s, key: %s", err.Error(), cookie, id)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("DeleteAPIKey: %d, cookie: %s, key: %s", http.StatusOK, cookie, id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("DeleteUser: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("DeleteUser: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Пароль может быть пустым только у аккаунта без пароля: его удаление подтверждается свежим входом.
+	user := userStruct{}
+	if err = json.Unmarshal(b, &user); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.db.DeleteUser(cookie.ID, user.Password, cookie.recentSignIn())
+	if err != nil {
+		if errors.Is(err, database.ErrWrongData) {
+			log.Printf("DeleteUser: %d, cookie: %s", http.StatusUnauthorized, cookie)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if errors.Is(err, database.ErrReauthRequired) {
+			log.Printf("DeleteUser: %d, cookie: %s, reauthentication required", http.StatusUnauthorized, cookie)
+			writeReauthRequired(w)
+			return
+		}
+
+		log.Printf("DeleteUser: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.setSessionCookies(w, "", "", time.Time{})
+	log.Printf("DeleteUser: %d, cookie: %s", http.StatusOK, cookie)
+	w.WriteHeader(http.StatusOK)
+}
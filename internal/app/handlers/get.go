@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/go-chi/chi/v5"
 )
 
 func (c *Controller) GetOrders(w http.ResponseWriter, r *http.Request) {
@@ -16,18 +18,19 @@ func (c *Controller) GetOrders(w http.ResponseWriter, r *http.Request) {
 	var cookie cookieStruct
 	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 	if err != nil {
-		log.Print("PostRegister: unmarshal cookie err: ", err.Error())
+		log.Print("GetOrders: unmarshal cookie err: ", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if cookie.Login == "" {
-		log.Printf("GetOrders: %d, cookie: %s", http.StatusUnauthorized, cookie)
-		w.WriteHeader(http.StatusUnauthorized)
+	var v violations
+	filter := parseOrderFilter(r.URL.Query(), &v)
+	if writeViolations(w, v) {
+		log.Printf("GetOrders: %d, cookie: %s, query: %s", http.StatusBadRequest, cookie, r.URL.RawQuery)
 		return
 	}
 
-	orders, err := c.db.GetOrders(cookie.Login)
+	orders, next, err := c.db.GetOrdersPage(cookie.Login, filter)
 	if err != nil {
 		if errors.Is(err, database.ErrEmpty) {
 			log.Printf("GetOrders: %d, cookie: %s", http.StatusNoContent, cookie)
@@ -47,35 +50,135 @@ func (c *Controller) GetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wr, err := w.Write(marshal)
+	// Ссылка на следующую страницу сохраняет фильтры и сортировку текущего запроса.
+	if next != nil {
+		cursor := encodeOrderCursor(*next)
+
+		u := *r.URL
+		q := u.Query()
+		q.Set("cursor", cursor)
+		u.RawQuery = q.Encode()
+
+		w.Header().Set("X-Next-Cursor", cursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+	}
+
+	_, err = w.Write(marshal)
 	if err != nil {
 		log.Print("GetOrders: w write err: ", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if wr == 0 {
-		w.WriteHeader(http.StatusNoContent)
+	log.Printf("GetOrders: %d, cookie: %s, orders: %d", http.StatusOK, cookie, len(orders))
+}
+
+func (c *Controller) GetOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetOrder: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	log.Printf("GetOrders: %d, cookie: %s", http.StatusOK, cookie)
+	number, ok := parseOrderNumber([]byte(chi.URLParam(r, "number")))
+	if !ok {
+		log.Printf("GetOrder: %d, cookie: %s, order: %s", http.StatusBadRequest, cookie, chi.URLParam(r, "number"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	order, err := c.db.GetOrder(cookie.Login, number)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("GetOrder: %d, cookie: %s, order: %s", http.StatusNotFound, cookie, number)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Printf("GetOrder: %s, cookie: %s, order: %s", err.Error(), cookie, number)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(order)
+	if err != nil {
+		log.Print("GetOrder: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(marshal); err != nil {
+		log.Print("GetOrder: w write err: ", err.Error())
+		return
+	}
+
+	log.Printf("GetOrder: %d, cookie: %s, order: %s", http.StatusOK, cookie, number)
 }
 
-func (c *Controller) GetBalance(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var cookie cookieStruct
 	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 	if err != nil {
-		log.Print("PostRegister: unmarshal cookie err: ", err.Error())
+		log.Print("GetOrderHistory: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	number, ok := parseOrderNumber([]byte(chi.URLParam(r, "number")))
+	if !ok {
+		log.Printf("GetOrderHistory: %d, cookie: %s, order: %s", http.StatusBadRequest, cookie, chi.URLParam(r, "number"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	history, err := c.db.GetOrderHistory(cookie.Login, number)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("GetOrderHistory: %d, cookie: %s, order: %s", http.StatusNotFound, cookie, number)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, database.ErrEmpty) {
+			log.Printf("GetOrderHistory: %d, cookie: %s, order: %s", http.StatusNoContent, cookie, number)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Printf("GetOrderHistory: %s, cookie: %s, order: %s", err.Error(), cookie, number)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if cookie.Login == "" {
-		log.Printf("GetBalance: %d, cookie: %s",
-			http.StatusUnauthorized, cookie)
-		w.WriteHeader(http.StatusUnauthorized)
+	marshal, err := json.Marshal(history)
+	if err != nil {
+		log.Print("GetOrderHistory: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(marshal); err != nil {
+		log.Print("GetOrderHistory: w write err: ", err.Error())
+		return
+	}
+
+	log.Printf("GetOrderHistory: %d, cookie: %s, order: %s", http.StatusOK, cookie, number)
+}
+
+func (c *Controller) GetBalance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostRegister: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
@@ -116,12 +219,6 @@ func (c *Controller) GetWithDrawAls(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if cookie.Login == "" {
-		log.Printf("GetWithDraw: %d, cookie: %s", http.StatusUnauthorized, cookie)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
 	withdraw, err := c.db.GetWithDraw(cookie.Login)
 	if err != nil {
 		if errors.Is(err, database.ErrEmpty) {
@@ -151,3 +248,310 @@ func (c *Controller) GetWithDrawAls(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("GetWithDraw: %d, cookie: %s", http.StatusOK, cookie)
 }
+
+func (c *Controller) GetSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetSessions: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := c.db.GetSessions(cookie.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrEmpty) {
+			log.Printf("GetSessions: %d, cookie: %s", http.StatusNoContent, cookie)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Printf("GetSessions: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == cookie.SessionID
+	}
+
+	marshal, err := json.Marshal(sessions)
+	if err != nil {
+		log.Print("GetSessions: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("GetSessions: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetSessions: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+func (c *Controller) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetAPIKeys: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	keys, err := c.db.GetAPIKeys(cookie.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrEmpty) {
+			log.Printf("GetAPIKeys: %d, cookie: %s", http.StatusNoContent, cookie)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Printf("GetAPIKeys: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(keys)
+	if err != nil {
+		log.Print("GetAPIKeys: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("GetAPIKeys: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetAPIKeys: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+func (c *Controller) GetExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetExport: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	export, err := c.db.Export(cookie.ID)
+	if err != nil {
+		log.Printf("GetExport: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for i := range export.Sessions {
+		export.Sessions[i].Current = export.Sessions[i].ID == cookie.SessionID
+	}
+
+	marshal, err := json.Marshal(export)
+	if err != nil {
+		log.Print("GetExport: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.json"`)
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("GetExport: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetExport: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+func (c *Controller) GetRoleUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	role := chi.URLParam(r, "role")
+	if !database.ValidRole(role) {
+		log.Printf("GetRoleUsers: %d, role: %s", http.StatusNotFound, role)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	logins, err := c.db.GetRoleUsers(role)
+	if err != nil {
+		if errors.Is(err, database.ErrEmpty) {
+			log.Printf("GetRoleUsers: %d, role: %s", http.StatusNoContent, role)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Printf("GetRoleUsers: %s, role: %s", err.Error(), role)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(logins)
+	if err != nil {
+		log.Print("GetRoleUsers: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("GetRoleUsers: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetRoleUsers: %d, role: %s", http.StatusOK, role)
+}
+
+func (c *Controller) GetProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetProfile: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := c.db.GetProfile(cookie.ID)
+	if err != nil {
+		log.Printf("GetProfile: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(profile)
+	if err != nil {
+		log.Print("GetProfile: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("GetProfile: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetProfile: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+// Размер выдачи журнала безопасности по умолчанию и наибольший допустимый.
+const (
+	securityEventsLimit    = 50
+	maxSecurityEventsLimit = 500
+)
+
+func (c *Controller) GetSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetSecurityEvents: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	limit := securityEventsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxSecurityEventsLimit {
+			var v violations
+			v.add("limit", "invalid", "limit must be an integer from 1 to %d", maxSecurityEventsLimit)
+			log.Printf("GetSecurityEvents: %d, cookie: %s, limit: %s", http.StatusBadRequest, cookie, s)
+			writeViolations(w, v)
+			return
+		}
+	}
+
+	events, err := c.db.GetSecurityEvents(cookie.ID, limit)
+	if err != nil {
+		if errors.Is(err, database.ErrEmpty) {
+			log.Printf("GetSecurityEvents: %d, cookie: %s", http.StatusNoContent, cookie)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Printf("GetSecurityEvents: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(events)
+	if err != nil {
+		log.Print("GetSecurityEvents: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("GetSecurityEvents: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetSecurityEvents: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+func (c *Controller) GetAdjustments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetAdjustments: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	number, ok := parseOrderNumber([]byte(chi.URLParam(r, "number")))
+	if !ok {
+		log.Printf("GetAdjustments: %d, cookie: %s, order: %s", http.StatusBadRequest, cookie, chi.URLParam(r, "number"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	adjustments, err := c.db.GetAdjustments(number)
+	if err != nil {
+		if errors.Is(err, database.ErrEmpty) {
+			log.Printf("GetAdjustments: %d, cookie: %s, order: %s", http.StatusNoContent, cookie, number)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Printf("GetAdjustments: %s, cookie: %s, order: %s", err.Error(), cookie, number)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(adjustments)
+	if err != nil {
+		log.Print("GetAdjustments: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(marshal); err != nil {
+		log.Print("GetAdjustments: w write err: ", err.Error())
+		return
+	}
+
+	log.Printf("GetAdjustments: %d, cookie: %s, order: %s", http.StatusOK, cookie, number)
+}
@@ -3,17 +3,19 @@ package handlers
 import (
 	"compress/gzip"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/totp"
 )
 
 type Middleware func(http.Handler) http.Handler
@@ -73,114 +75,402 @@ func gzipMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func generateRandom(size int) ([]byte, error) {
-	b := make([]byte, size)
-	_, err := rand.Read(b)
+var userIdentification = "user_identification"
+
+var userLogin = "user_login"
+
+var identification struct {
+	cookie string
+}
+
+type cookieStruct struct {
+	ID        string    `json:"id"`
+	Login     string    `json:"login"`
+	SessionID string    `json:"session_id"`
+	Verified  bool      `json:"verified"`
+	Role      string    `json:"role,omitempty"`
+	APIKey    string    `json:"api_key,omitempty"` // идентификатор API-ключа, если запрос выполнен по ключу
+	Scopes    []string  `json:"scopes,omitempty"`
+	SignedIn  time.Time `json:"signed_in,omitempty"` // когда открыта сессия, нулевое для API-ключей
+
+	idleUntil time.Time // до какого момента действует cookie сессии без новых обращений
+}
+
+// reauthWindow - сколько после входа сессия считается свежей.
+const reauthWindow = 5 * time.Minute
+
+// recentSignIn сообщает, что сессия открыта недавно. Для аккаунтов без пароля свежий вход
+// заменяет ввод текущего пароля при смене пароля и удалении учетной записи.
+func (c cookieStruct) recentSignIn() bool {
+	return !c.SignedIn.IsZero() && time.Since(c.SignedIn) < reauthWindow
+}
+
+// String используется в логах хендлеров и не раскрывает идентификатор сессии.
+func (c cookieStruct) String() string {
+	return fmt.Sprintf("{%s %s}", c.ID, c.Login)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// startSession создает сессию в базе данных и выдает клиенту подписанный токен этой сессии:
+// браузеру в cookie, остальным клиентам в заголовке Authorization.
+// verified отмечает, что пользователь уже прошел проверку второго фактора.
+func (c *Controller) startSession(w http.ResponseWriter, r *http.Request, userID, login string, verified bool) error {
+	now := time.Now()
+	expiresAt := now.Add(c.c.SessionLifetime)
+
+	sessionID, err := c.db.AddSession(userID, r.UserAgent(), clientIP(r), expiresAt, c.c.SessionIdleTimeout)
+	if err != nil {
+		return err
+	}
+
+	if verified {
+		if err = c.db.SetSessionMFA(sessionID); err != nil {
+			return err
+		}
+	}
+
+	tok, err := c.makeToken(sessionID, userID, login, expiresAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return b, nil
+	idleUntil := now.Add(c.c.SessionIdleTimeout)
+	if idleUntil.After(expiresAt) {
+		idleUntil = expiresAt
+	}
+
+	c.setSessionCookies(w, tok, login, idleUntil)
+	w.Header().Set("Authorization", bearerPrefix+tok)
+
+	return nil
+}
+
+// setSessionCookies выдает cookie сессии до момента until. Пустой токен удаляет cookie.
+func (c *Controller) setSessionCookies(w http.ResponseWriter, tok, login string, until time.Time) {
+	maxAge := int(math.Ceil(time.Until(until).Seconds()))
+	if tok == "" || maxAge <= 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     userIdentification,
+		Value:    tok,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     userLogin,
+		Value:    login,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: false,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
 
-func makeUserIdentification() (string, error) {
-	str := time.Now().Format("02012006150405")
+// checkSecondFactor проверяет TOTP-код или, если он не передан, одноразовый код восстановления.
+func (c *Controller) checkSecondFactor(userID, secret, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.ValidateStep(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		if err := c.db.UseTOTPStep(userID, step); err != nil {
+			if errors.Is(err, database.ErrUsed) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		return true, nil
+	}
 
-	key, err := generateRandom(aes.BlockSize)
+	err := c.db.UseRecoveryCode(userID, recoveryCode)
 	if err != nil {
-		return "", err
+		if errors.Is(err, database.ErrWrongData) {
+			return false, nil
+		}
+
+		return false, err
 	}
 
-	aesblock, err := aes.NewCipher(key)
+	return true, nil
+}
+
+// checkToken проверяет подпись токена и то, что его сессия не была завершена, либо находит API-ключ.
+func (c *Controller) checkToken(s string) (cookieStruct, error) {
+	if strings.HasPrefix(s, database.APIKeyPrefix) {
+		key, err := c.db.CheckAPIKey(s)
+		if err != nil {
+			return cookieStruct{}, err
+		}
+
+		return cookieStruct{ID: key.UserID, Login: key.Login, Verified: key.Verified, APIKey: key.ID, Scopes: key.Scopes}, nil
+	}
+
+	tok, err := c.parseToken(s)
 	if err != nil {
-		return "", err
+		return cookieStruct{}, err
 	}
 
-	aesgcm, err := cipher.NewGCM(aesblock)
+	session, err := c.db.CheckSession(tok.SessionID)
 	if err != nil {
-		return "", err
+		return cookieStruct{}, err
+	}
+
+	if session.UserID != tok.UserID {
+		return cookieStruct{}, errBadToken
 	}
 
-	nonce, err := generateRandom(aesgcm.NonceSize())
+	idleUntil, err := time.Parse(time.RFC3339, session.IdleUntil)
 	if err != nil {
-		return "", err
+		return cookieStruct{}, err
 	}
 
-	id := fmt.Sprintf("%x", aesgcm.Seal(nil, nonce, []byte(str), nil))
+	signedIn, err := time.Parse(time.RFC3339, session.CreatedAt)
+	if err != nil {
+		return cookieStruct{}, err
+	}
 
-	return id, nil
+	return cookieStruct{ID: session.UserID, Login: session.Login, SessionID: session.ID, Verified: session.Verified,
+		Role: session.Role, SignedIn: signedIn, idleUntil: idleUntil}, nil
 }
 
-var userIdentification = "user_identification"
+var bearerPrefix = "Bearer "
 
-var userLogin = "user_login"
+// requestToken достает токен сессии из заголовка Authorization: Bearer, а при его отсутствии из cookie.
+func requestToken(r *http.Request) (string, bool, error) {
+	if auth := r.Header.Get("Authorization"); len(auth) > len(bearerPrefix) &&
+		strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(auth[len(bearerPrefix):]), false, nil
+	}
 
-var identification struct {
-	cookie string
-}
+	cookie, err := r.Cookie(userIdentification)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			return "", false, err
+		}
 
-type cookieStruct struct {
-	ID    string `json:"id"`
-	Login string `json:"login"`
+		return "", false, nil
+	}
+
+	return cookie.Value, true, nil
 }
 
 func (c *Controller) cookieMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var uid string
+		var user cookieStruct
+
+		tok, fromCookie, err := requestToken(r)
+		if err != nil {
+			log.Print("cookieMiddleware: request token err: ", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if tok != "" {
+			user, err = c.checkToken(tok)
+			if err != nil {
+				if !errors.Is(err, errBadToken) && !errors.Is(err, errTokenExpired) &&
+					!errors.Is(err, database.ErrNotFound) {
+					log.Print("cookieMiddleware: check session err: ", err.Error())
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				// Поддельный, просроченный или завершенный токен: запрос обрабатывается как анонимный,
+				// поэтому хендлеры, требующие аутентификации, ответят 401.
+				log.Print("cookieMiddleware: check token err: ", err.Error())
+				if fromCookie {
+					c.setSessionCookies(w, "", "", time.Time{})
+				}
+			} else if fromCookie && user.SessionID != "" {
+				// Обращение продлило сессию в базе: cookie продлевается вместе с ней.
+				c.setSessionCookies(w, tok, user.Login, user.idleUntil)
+			}
+		}
 
-		cookie, err := r.Cookie(userIdentification)
+		marshal, err := json.Marshal(user)
 		if err != nil {
-			if !errors.Is(err, http.ErrNoCookie) {
-				log.Print("cookieMiddleware: r.Cookie err: ", err.Error())
+			log.Print("cookieMiddleware: marshal err: ", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), identification, marshal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireUser пропускает только аутентифицированные запросы, остальным отвечает 401.
+func (c *Controller) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookie cookieStruct
+		err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+		if err != nil {
+			log.Print("RequireUser: unmarshal cookie err: ", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if cookie.Login == "" {
+			log.Printf("RequireUser: %d, path: %s", http.StatusUnauthorized, r.URL.Path)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole пропускает только сессии пользователей с одной из ролей. Привилегированные действия
+// недоступны по API-ключам и до прохождения второго фактора.
+func (c *Controller) RequireRole(roles ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var cookie cookieStruct
+			err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+			if err != nil {
+				log.Print("RequireRole: unmarshal cookie err: ", err.Error())
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			uid, err = makeUserIdentification()
+			if cookie.Login == "" {
+				log.Printf("RequireRole: %d, path: %s", http.StatusUnauthorized, r.URL.Path)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if !cookie.hasRole(roles...) {
+				log.Printf("RequireRole: %d, cookie: %s, role: %s, path: %s",
+					http.StatusForbidden, cookie, cookie.Role, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (c cookieStruct) hasRole(roles ...string) bool {
+	if c.APIKey != "" || !c.Verified {
+		return false
+	}
+
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Права API-ключей. Сессии пользователя обладают всеми правами.
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeBalanceRead = "balance:read"
+	ScopeWithdraw    = "withdraw"
+)
+
+var scopes = map[string]bool{ScopeOrdersRead: true, ScopeOrdersWrite: true, ScopeBalanceRead: true, ScopeWithdraw: true}
+
+func (c cookieStruct) hasScope(scope string) bool {
+	if c.APIKey == "" {
+		return true
+	}
+
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequireScope запрещает запросы по API-ключам без нужного права.
+func (c *Controller) RequireScope(scope string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var cookie cookieStruct
+			err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 			if err != nil {
-				log.Print("cookieMiddleware: set user identification err: ", err.Error())
+				log.Print("RequireScope: unmarshal cookie err: ", err.Error())
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			http.SetCookie(w, &http.Cookie{
-				Name:     userIdentification,
-				Value:    uid,
-				Path:     "/",
-				MaxAge:   3600,
-				HttpOnly: false,
-				Secure:   false,
-				SameSite: http.SameSiteLaxMode,
-			})
-		} else {
-			uid = cookie.Value
-		}
+			if !cookie.hasScope(scope) {
+				log.Printf("RequireScope: %d, cookie: %s, key: %s, scope: %s",
+					http.StatusForbidden, cookie, cookie.APIKey, scope)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
 
-		login, err := c.db.Authentication(uid)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerified закрывает управление учетной записью для сессий, еще не прошедших второй фактор:
+// до проверки кода такая сессия подтверждена только паролем.
+func (c *Controller) RequireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookie cookieStruct
+		err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 		if err != nil {
-			log.Print("cookieMiddleware: set user authentication err: ", err.Error())
+			log.Print("RequireVerified: unmarshal cookie err: ", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     userLogin,
-			Value:    login,
-			Path:     "/",
-			MaxAge:   3600,
-			HttpOnly: false,
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
-		})
+		if !cookie.Verified {
+			log.Printf("RequireVerified: %d, cookie: %s, second factor required, path: %s",
+				http.StatusForbidden, cookie, r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 
-		marshal, err := json.Marshal(cookieStruct{ID: uid, Login: login})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SessionOnly закрывает управление учетной записью для запросов по API-ключам.
+func (c *Controller) SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookie cookieStruct
+		err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 		if err != nil {
-			log.Print("cookieMiddleware: marshal err: ", err.Error())
+			log.Print("SessionOnly: unmarshal cookie err: ", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), identification, marshal)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if cookie.APIKey != "" {
+			log.Printf("SessionOnly: %d, cookie: %s, key: %s", http.StatusForbidden, cookie, cookie.APIKey)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
 	})
 }
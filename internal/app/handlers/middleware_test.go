@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		authorization  string
+		cookie         string
+		wantToken      string
+		wantFromCookie bool
+	}{
+		{
+			name:           "Без токена",
+			wantToken:      "",
+			wantFromCookie: false,
+		},
+		{
+			name:           "Bearer",
+			authorization:  "Bearer header.token",
+			wantToken:      "header.token",
+			wantFromCookie: false,
+		},
+		{
+			name:           "Bearer приоритетнее cookie",
+			authorization:  "bearer header.token",
+			cookie:         "cookie.token",
+			wantToken:      "header.token",
+			wantFromCookie: false,
+		},
+		{
+			name:           "Другая схема авторизации",
+			authorization:  "username",
+			cookie:         "cookie.token",
+			wantToken:      "cookie.token",
+			wantFromCookie: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: userIdentification, Value: tt.cookie})
+			}
+
+			got, fromCookie, err := requestToken(r)
+			if err != nil {
+				t.Errorf("requestToken() error = %v", err)
+				return
+			}
+			if got != tt.wantToken || fromCookie != tt.wantFromCookie {
+				t.Errorf("requestToken() = %v, %v, want %v, %v", got, fromCookie, tt.wantToken, tt.wantFromCookie)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	c := NewController(config.Config{}, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		cookie cookieStruct
+		want   int
+	}{
+		{
+			name:   "Сессия пользователя",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session"},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "Ключ с нужным правом",
+			cookie: cookieStruct{ID: "1", Login: "username", APIKey: "key", Scopes: []string{ScopeOrdersRead}},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "Ключ без нужного права",
+			cookie: cookieStruct{ID: "1", Login: "username", APIKey: "key", Scopes: []string{ScopeBalanceRead}},
+			want:   http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marshal, err := json.Marshal(tt.cookie)
+			if err != nil {
+				t.Fatalf("json marshal err: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			r = r.WithContext(context.WithValue(r.Context(), identification, marshal))
+			w := httptest.NewRecorder()
+
+			c.RequireScope(ScopeOrdersRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("RequireScope() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	c := NewController(config.Config{}, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		cookie cookieStruct
+		want   int
+	}{
+		{
+			name:   "Без аутентификации",
+			cookie: cookieStruct{},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "Обычный пользователь",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session", Verified: true, Role: "user"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "Сотрудник поддержки",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session", Verified: true, Role: "support"},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "Администратор без второго фактора",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session", Verified: false, Role: "admin"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "Администратор",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session", Verified: true, Role: "admin"},
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marshal, err := json.Marshal(tt.cookie)
+			if err != nil {
+				t.Fatalf("json marshal err: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodDelete, "/api/admin/lockouts/username", nil)
+			r = r.WithContext(context.WithValue(r.Context(), identification, marshal))
+			w := httptest.NewRecorder()
+
+			c.RequireRole("support", "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("RequireRole() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireVerified(t *testing.T) {
+	c := NewController(config.Config{}, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		cookie cookieStruct
+		want   int
+	}{
+		{
+			name:   "Сессия без второго фактора",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session", Verified: false},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "Сессия, прошедшая второй фактор",
+			cookie: cookieStruct{ID: "1", Login: "username", SessionID: "session", Verified: true},
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marshal, err := json.Marshal(tt.cookie)
+			if err != nil {
+				t.Fatalf("json marshal err: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/user/password", nil)
+			r = r.WithContext(context.WithValue(r.Context(), identification, marshal))
+			w := httptest.NewRecorder()
+
+			c.RequireVerified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("RequireVerified() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSessionCookies(t *testing.T) {
+	c := NewController(config.Config{}, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		tok    string
+		until  time.Time
+		maxAge int
+	}{
+		{
+			name:   "Продление до конца простоя",
+			tok:    "token",
+			until:  time.Now().Add(30 * time.Minute),
+			maxAge: 1800,
+		},
+		{
+			name:   "Сессия уже истекла",
+			tok:    "token",
+			until:  time.Now().Add(-time.Minute),
+			maxAge: -1,
+		},
+		{
+			name:   "Удаление cookie",
+			tok:    "",
+			until:  time.Time{},
+			maxAge: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.setSessionCookies(w, tt.tok, "username", tt.until)
+
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.MaxAge != tt.maxAge {
+					t.Errorf("setSessionCookies() %s MaxAge = %d, want %d", cookie.Name, cookie.MaxAge, tt.maxAge)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/oidc"
+)
+
+var oidcStateCookie = "oidc_state"
+
+// oidcStateLifetime - сколько у пользователя есть времени на вход у провайдера.
+const oidcStateLifetime = 10 * time.Minute
+
+// oidcState хранится в подписанной cookie между переходом к провайдеру и возвратом от него.
+type oidcState struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	LinkUser  string `json:"link_user,omitempty"` // пользователь, к которому привязывается внешняя учетная запись
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c *Controller) makeOIDCState(s oidcState) (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	return payload + "." + c.sign("oidc:"+payload), nil
+}
+
+func (c *Controller) parseOIDCState(v string) (oidcState, error) {
+	payload, signature, ok := strings.Cut(v, ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(signature), []byte(c.sign("oidc:"+payload))) != 1 {
+		return oidcState{}, errBadToken
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return oidcState{}, errBadToken
+	}
+
+	var s oidcState
+	if err = json.Unmarshal(b, &s); err != nil {
+		return oidcState{}, errBadToken
+	}
+
+	if time.Now().Unix() >= s.ExpiresAt {
+		return oidcState{}, errTokenExpired
+	}
+
+	return s, nil
+}
+
+func (c *Controller) setOIDCStateCookie(w http.ResponseWriter, v string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    v,
+		Path:     "/api/user/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcLogin подбирает логин для нового пользователя из утверждений провайдера.
+// Если ни preferred_username, ни email не проходят политику логинов, логин строится из subject.
+func (c *Controller) oidcLogin(claims oidc.Claims) string {
+	local, _, _ := strings.Cut(claims.Email, "@")
+	for _, candidate := range []string{claims.PreferredUsername, local} {
+		var v violations
+		validateLogin(c.c, candidate, &v)
+		if len(v.Errors) == 0 {
+			return candidate
+		}
+	}
+
+	sum := sha256.Sum256([]byte(claims.Issuer + "\x00" + claims.Subject))
+
+	return "sso-" + hex.EncodeToString(sum[:5])
+}
+
+func (c *Controller) GetOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetOIDCLogin: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s := oidcState{ExpiresAt: time.Now().Add(oidcStateLifetime).Unix()}
+	for _, v := range []*string{&s.State, &s.Nonce, &s.Verifier} {
+		if *v, err = oidc.RandomString(); err != nil {
+			log.Print("GetOIDCLogin: random string err: ", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Вход из уже открытой сессии привязывает внешнюю учетную запись к текущему пользователю.
+	// Маршрут открыт и для анонимного входа, поэтому второй фактор для привязки проверяется здесь.
+	if cookie.SessionID != "" {
+		if !cookie.Verified {
+			log.Printf("GetOIDCLogin: %d, cookie: %s, second factor required", http.StatusForbidden, cookie)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		s.LinkUser = cookie.ID
+	}
+
+	authURL, err := c.oidc.AuthURL(r.Context(), s.State, s.Nonce, s.Verifier)
+	if err != nil {
+		log.Print("GetOIDCLogin: auth url err: ", err.Error())
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	v, err := c.makeOIDCState(s)
+	if err != nil {
+		log.Print("GetOIDCLogin: make state err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.setOIDCStateCookie(w, v, int(oidcStateLifetime.Seconds()))
+	log.Printf("GetOIDCLogin: %d, cookie: %s", http.StatusFound, cookie)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (c *Controller) GetOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("GetOIDCCallback: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	stateCookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		log.Printf("GetOIDCCallback: %d, no state cookie", http.StatusBadRequest)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// State одноразовый: cookie удаляется при любом исходе.
+	c.setOIDCStateCookie(w, "", -1)
+
+	s, err := c.parseOIDCState(stateCookie.Value)
+	if err != nil || subtle.ConstantTimeCompare([]byte(s.State), []byte(r.URL.Query().Get("state"))) != 1 {
+		log.Printf("GetOIDCCallback: %d, bad state", http.StatusBadRequest)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		log.Printf("GetOIDCCallback: %d, provider error: %s", http.StatusUnauthorized, e)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := c.oidc.Exchange(r.Context(), r.URL.Query().Get("code"), s.Verifier, s.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrExchange) || errors.Is(err, oidc.ErrBadIDToken) {
+			log.Printf("GetOIDCCallback: %d, err: %s", http.StatusUnauthorized, err.Error())
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		log.Print("GetOIDCCallback: exchange err: ", err.Error())
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if s.LinkUser != "" {
+		c.linkOIDCIdentity(w, cookie, s.LinkUser, claims)
+		return
+	}
+
+	userID, login, err := c.db.ExternalLogin(c.oidc.Issuer(), claims.Subject, c.oidcLogin(claims), c.c.LoginMaxLength)
+	if err != nil {
+		if errors.Is(err, database.ErrUsed) {
+			log.Printf("GetOIDCCallback: %d, subject: %s", http.StatusConflict, claims.Subject)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		log.Printf("GetOIDCCallback: %s, subject: %s", err.Error(), claims.Subject)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, enabled, err := c.db.GetTOTP(userID)
+	if err != nil {
+		log.Printf("GetOIDCCallback: get totp err: %s, login: %s", err.Error(), login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = c.startSession(w, r, userID, login, false); err != nil {
+		log.Print("GetOIDCCallback: start session err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, database.EventLoginSuccess, userID, login, "oidc: "+claims.Subject)
+	log.Printf("GetOIDCCallback: %d, login: %s, subject: %s", http.StatusOK, login, claims.Subject)
+	w.WriteHeader(http.StatusOK)
+
+	if enabled {
+		if _, err = w.Write([]byte(`{"two_factor_required":true}`)); err != nil {
+			log.Print("GetOIDCCallback: w write err: ", err.Error())
+		}
+	}
+}
+
+func (c *Controller) linkOIDCIdentity(w http.ResponseWriter, cookie cookieStruct, userID string, claims oidc.Claims) {
+	// Привязка возможна только из той же учетной записи, из которой она была начата.
+	if cookie.ID != userID || cookie.APIKey != "" {
+		log.Printf("GetOIDCCallback: %d, cookie: %s, link user: %s", http.StatusUnauthorized, cookie, userID)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := c.db.LinkIdentity(userID, c.oidc.Issuer(), claims.Subject)
+	if err != nil {
+		if errors.Is(err, database.ErrUsed) {
+			log.Printf("GetOIDCCallback: %d, cookie: %s, subject: %s", http.StatusConflict, cookie, claims.Subject)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		log.Printf("GetOIDCCallback: %s, cookie: %s, subject: %s", err.Error(), cookie, claims.Subject)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GetOIDCCallback: %d, cookie: %s, linked subject: %s", http.StatusOK, cookie, claims.Subject)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/oidc"
+)
+
+func TestOIDCState(t *testing.T) {
+	c := NewController(config.Config{SecretKey: "secret"}, nil, nil, nil)
+
+	valid, err := c.makeOIDCState(oidcState{State: "state", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("makeOIDCState() error = %v", err)
+	}
+
+	expired, err := c.makeOIDCState(oidcState{State: "state", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("makeOIDCState() error = %v", err)
+	}
+
+	// Токен сессии с той же подписью не должен приниматься как state.
+	session, err := c.makeToken("session", "1", "username", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("makeToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{
+			name:    "Действительный state",
+			value:   valid,
+			wantErr: nil,
+		},
+		{
+			name:    "Истекший state",
+			value:   expired,
+			wantErr: errTokenExpired,
+		},
+		{
+			name:    "Подделанная подпись",
+			value:   strings.Split(valid, ".")[0] + ".forged",
+			wantErr: errBadToken,
+		},
+		{
+			name:    "Токен сессии",
+			value:   session,
+			wantErr: errBadToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.parseOIDCState(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseOIDCState() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.State != "state" {
+				t.Errorf("parseOIDCState() got = %v", got)
+			}
+		})
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	c := NewController(testPolicy, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		claims oidc.Claims
+		want   string
+	}{
+		{
+			name:   "preferred_username",
+			claims: oidc.Claims{Subject: "1", PreferredUsername: "username", Email: "mail@example.com"},
+			want:   "username",
+		},
+		{
+			name:   "Логин из email",
+			claims: oidc.Claims{Subject: "1", PreferredUsername: "user name", Email: "mail@example.com"},
+			want:   "mail",
+		},
+		{
+			name:   "Зарезервированный логин",
+			claims: oidc.Claims{Issuer: "issuer", Subject: "1", PreferredUsername: "admin"},
+			want:   "sso-",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.oidcLogin(tt.claims); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("oidcLogin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+)
+
+const maxOrdersLimit = 1000
+
+// orderCursor - курсор страницы заказов в том виде, в котором он уходит клиенту.
+// Для клиента курсор непрозрачен: он только передается обратно в параметре cursor.
+type orderCursor struct {
+	UploadedAt time.Time `json:"t"`
+	Number     string    `json:"n"`
+}
+
+func encodeOrderCursor(c database.OrderCursor) string {
+	b, _ := json.Marshal(orderCursor{UploadedAt: c.UploadedAt, Number: c.Number})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeOrderCursor(s string) (*database.OrderCursor, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+
+	var c orderCursor
+	if err = json.Unmarshal(b, &c); err != nil || c.UploadedAt.IsZero() || c.Number == "" {
+		return nil, false
+	}
+
+	return &database.OrderCursor{UploadedAt: c.UploadedAt, Number: c.Number}, true
+}
+
+// parseOrderFilter разбирает параметры GET /api/user/orders:
+// limit, status (через запятую или повтором), from и to (RFC3339, to не включается),
+// sort (uploaded_at, по умолчанию, - сначала старые, как требует спецификация; -uploaded_at - сначала новые)
+// и cursor. Без параметров возвращается полный список. С limit ответ ограничен страницей; если заказов
+// больше, он содержит Link и X-Next-Cursor на следующую страницу.
+func parseOrderFilter(q url.Values, v *violations) database.OrderFilter {
+	var f database.OrderFilter
+
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxOrdersLimit {
+			v.add("limit", "invalid", "limit must be an integer from 1 to %d", maxOrdersLimit)
+		}
+
+		f.Limit = limit
+	}
+
+	for _, s := range q["status"] {
+		for _, raw := range strings.Split(s, ",") {
+			status := database.OrderStatus(strings.ToUpper(strings.TrimSpace(raw)))
+			if !status.Valid() {
+				v.add("status", "invalid", "status must be one of %v", database.OrderStatuses)
+				break
+			}
+
+			f.Statuses = append(f.Statuses, string(status))
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if s := q.Get(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				v.add(p.name, "invalid", "%s must be a date in RFC3339 format", p.name)
+				continue
+			}
+
+			*p.t = t
+		}
+	}
+
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		v.add("to", "invalid", "to must be later than from")
+	}
+
+	switch q.Get("sort") {
+	case "", "uploaded_at":
+	case "-uploaded_at":
+		f.Desc = true
+	default:
+		v.add("sort", "invalid", "sort must be uploaded_at or -uploaded_at")
+	}
+
+	if s := q.Get("cursor"); s != "" {
+		cursor, ok := decodeOrderCursor(s)
+		if !ok {
+			v.add("cursor", "invalid", "cursor is malformed")
+		}
+
+		f.After = cursor
+	}
+
+	return f
+}
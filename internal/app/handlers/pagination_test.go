@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+)
+
+func TestOrderCursor(t *testing.T) {
+	want := database.OrderCursor{UploadedAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC), Number: "0049927398716"}
+
+	got, ok := decodeOrderCursor(encodeOrderCursor(want))
+	if !ok || !got.UploadedAt.Equal(want.UploadedAt) || got.Number != want.Number {
+		t.Errorf("decodeOrderCursor() = %v, %v, want %v", got, ok, want)
+	}
+
+	if _, ok = decodeOrderCursor("not a cursor"); ok {
+		t.Errorf("decodeOrderCursor() accepted a malformed cursor")
+	}
+}
+
+func TestParseOrderFilter(t *testing.T) {
+	from := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		query string
+		want  database.OrderFilter
+		codes []string
+	}{
+		{
+			name:  "По умолчанию",
+			query: "",
+			want:  database.OrderFilter{},
+		},
+		{
+			name:  "Сначала новые",
+			query: "sort=-uploaded_at",
+			want:  database.OrderFilter{Desc: true},
+		},
+		{
+			name:  "Фильтры и сортировка",
+			query: "limit=10&status=new,processing&status=PROCESSED&from=2023-05-01T00:00:00Z&sort=-uploaded_at",
+			want: database.OrderFilter{
+				Statuses: []string{"NEW", "PROCESSING", "PROCESSED"},
+				From:     from,
+				Desc:     true,
+				Limit:    10,
+			},
+		},
+		{
+			name:  "Неверные параметры",
+			query: "limit=0&status=DONE&from=yesterday&sort=number&cursor=xyz",
+			codes: []string{"invalid", "invalid", "invalid", "invalid", "invalid"},
+		},
+		{
+			name:  "Пустой интервал",
+			query: "from=2023-05-01T00:00:00Z&to=2023-05-01T00:00:00Z",
+			codes: []string{"invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var v violations
+			got := parseOrderFilter(q, &v)
+			if gotCodes := codes(v); !reflect.DeepEqual(gotCodes, tt.codes) {
+				t.Errorf("parseOrderFilter() violations = %v, want %v", gotCodes, tt.codes)
+				return
+			}
+
+			if tt.codes == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOrderFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+)
+
+// profileStruct - изменяемые поля профиля. Отсутствующее поле не меняется, пустая строка удаляет контакт.
+type profileStruct struct {
+	Email *string `json:"email"`
+	Phone *string `json:"phone"`
+}
+
+func (c *Controller) PatchProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PatchProfile: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PatchProfile: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	profile := profileStruct{}
+	if err = json.Unmarshal(b, &profile); err != nil {
+		log.Printf("PatchProfile: %d, cookie: %s, json unmarshal err: %s", http.StatusBadRequest, cookie, err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	var v violations
+	if profile.Email != nil {
+		validateEmail(*profile.Email, &v)
+	}
+	if profile.Phone != nil {
+		validatePhone(*profile.Phone, &v)
+	}
+	if writeViolations(w, v) {
+		log.Printf("PatchProfile: %d, cookie: %s, violations: %v", http.StatusBadRequest, cookie, v.Errors)
+		return
+	}
+
+	err = c.db.UpdateProfile(cookie.ID, map[string]*string{
+		database.ChannelEmail: profile.Email,
+		database.ChannelPhone: profile.Phone,
+	})
+	if err != nil {
+		log.Printf("PatchProfile: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := c.db.GetProfile(cookie.ID)
+	if err != nil {
+		log.Printf("PatchProfile: get profile err: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(updated)
+	if err != nil {
+		log.Print("PatchProfile: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("PatchProfile: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PatchProfile: %d, cookie: %s", http.StatusOK, cookie)
+}
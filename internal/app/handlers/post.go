@@ -6,29 +6,28 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/totp"
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/worker"
+	"github.com/go-chi/chi/v5"
 )
 
 type userStruct struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
 }
 
 func (c *Controller) PostRegister(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var cookie cookieStruct
-	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
-	if err != nil {
-		log.Print("PostRegister: unmarshal cookie err: ", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Print("PostRegister: read all err: ", err.Error())
@@ -44,43 +43,46 @@ func (c *Controller) PostRegister(w http.ResponseWriter, r *http.Request) {
 	user := userStruct{}
 	err = json.Unmarshal(b, &user)
 	if err != nil {
-		log.Print("PostRegister: json unmarshal err: ", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("PostRegister: %d, json unmarshal err: %s", http.StatusBadRequest, err.Error())
+		writeBadJSON(w, err)
 		return
 	}
 
-	err = c.db.Register(user.Login, user.Password, cookie.ID)
+	var v violations
+	validateLogin(c.c, user.Login, &v)
+	validatePassword(c.c, user.Login, user.Password, &v)
+	if writeViolations(w, v) {
+		log.Printf("PostRegister: %d, login: %s, violations: %v", http.StatusBadRequest, user.Login, v.Errors)
+		return
+	}
+
+	userID, err := c.db.Register(user.Login, user.Password)
 	if err != nil {
 		if errors.Is(err, database.ErrRegisterConflict) {
-			log.Printf("PostRegister: %d, cookie: %s, login: %s, password: %s",
-				http.StatusConflict, cookie, user.Login, user.Password)
+			log.Printf("PostRegister: %d, login: %s", http.StatusConflict, user.Login)
 			w.WriteHeader(http.StatusConflict)
 			return
 		}
 
-		log.Printf("PostRegister: %s, cookie: %s, login: %s, password: %s",
-			err.Error(), cookie, user.Login, user.Password)
+		log.Printf("PostRegister: %s, login: %s", err.Error(), user.Login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = c.startSession(w, r, userID, user.Login, false); err != nil {
+		log.Print("PostRegister: start session err: ", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Authorization", user.Login)
-	log.Printf("PostRegister: %d, cookie: %s, login: %s, password: %s",
-		http.StatusOK, cookie, user.Login, user.Password)
+	c.audit(r, database.EventRegister, userID, user.Login, "")
+	log.Printf("PostRegister: %d, login: %s", http.StatusOK, user.Login)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (c *Controller) PostLogin(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var cookie cookieStruct
-	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
-	if err != nil {
-		log.Print("PostLogin: unmarshal cookie err: ", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Print("PostLogin: read all err: ", err.Error())
@@ -96,26 +98,129 @@ func (c *Controller) PostLogin(w http.ResponseWriter, r *http.Request) {
 	user := userStruct{}
 	err = json.Unmarshal(b, &user)
 	if err != nil {
-		log.Print("PostLogin: json unmarshal err: ", err.Error())
+		log.Printf("PostLogin: %d, json unmarshal err: %s", http.StatusBadRequest, err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	// Политика применяется только к новым учетным данным, здесь проверяется лишь их наличие.
+	var v violations
+	if user.Login == "" {
+		v.add("login", "required", "login is required")
+	}
+	if user.Password == "" {
+		v.add("password", "required", "password is required")
+	}
+	if writeViolations(w, v) {
+		log.Printf("PostLogin: %d, login: %s, violations: %v", http.StatusBadRequest, user.Login, v.Errors)
+		return
+	}
+
+	loginKey, ipKey := "login:"+user.Login, "ip:"+clientIP(r)
+
+	lockout, err := c.db.GetLockout(loginKey, ipKey)
+	if err != nil {
+		log.Printf("PostLogin: get lockout err: %s, login: %s", err.Error(), user.Login)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	var status = http.StatusOK
-	err = c.db.Login(user.Login, user.Password, cookie.ID)
+	if lockout > 0 {
+		c.audit(r, database.EventLoginFailure, "", user.Login, "locked out")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+		log.Printf("PostLogin: %d, login: %s, retry after: %s", http.StatusTooManyRequests, user.Login, lockout)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	userID, err := c.db.Login(user.Login, user.Password)
 	if err != nil {
 		if !errors.Is(err, database.ErrWrongData) {
-			log.Printf("PostLogin: %s, login: %s, password: %s", err.Error(), user.Login, user.Password)
+			log.Printf("PostLogin: %s, login: %s", err.Error(), user.Login)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		status = http.StatusUnauthorized
+		c.addLoginFailure(loginKey, ipKey)
+		c.audit(r, database.EventLoginFailure, "", user.Login, "wrong password")
+		log.Printf("PostLogin: %d, login: %s", http.StatusUnauthorized, user.Login)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
-	w.Header().Set("Authorization", user.Login)
-	log.Printf("PostLogin: %d, cookie: %s, login: %s, password: %s", status, cookie, user.Login, user.Password)
-	w.WriteHeader(status)
+	secret, enabled, err := c.db.GetTOTP(userID)
+	if err != nil {
+		log.Printf("PostLogin: get totp err: %s, login: %s", err.Error(), user.Login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Второй фактор можно передать сразу вместе с паролем или позже через /api/user/2fa/verify.
+	var verified bool
+	if enabled && (user.Code != "" || user.RecoveryCode != "") {
+		verified, err = c.checkSecondFactor(userID, secret, user.Code, user.RecoveryCode)
+		if err != nil {
+			log.Printf("PostLogin: check second factor err: %s, login: %s", err.Error(), user.Login)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !verified {
+			c.addLoginFailure(loginKey, ipKey)
+			c.audit(r, database.EventLoginFailure, userID, user.Login, "wrong second factor")
+			log.Printf("PostLogin: %d, login: %s, bad second factor", http.StatusUnauthorized, user.Login)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Пока второй фактор не пройден, счетчик не сбрасывается: иначе повторный вход по паролю снимал бы
+	// ограничение на подбор кода через /api/user/2fa/verify.
+	if !enabled || verified {
+		if err = c.db.ResetLoginFailures(loginKey); err != nil {
+			log.Printf("PostLogin: reset login failures err: %s, login: %s", err.Error(), user.Login)
+		}
+	}
+
+	if err = c.startSession(w, r, userID, user.Login, verified); err != nil {
+		log.Print("PostLogin: start session err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	details := ""
+	if enabled && !verified {
+		details = "second factor pending"
+	}
+
+	c.audit(r, database.EventLoginSuccess, userID, user.Login, details)
+	log.Printf("PostLogin: %d, login: %s", http.StatusOK, user.Login)
+	w.WriteHeader(http.StatusOK)
+
+	if enabled && !verified {
+		if _, err = w.Write([]byte(`{"two_factor_required":true}`)); err != nil {
+			log.Print("PostLogin: w write err: ", err.Error())
+		}
+	}
+}
+
+// writeReauthRequired отвечает аккаунту без пароля, что действие нужно подтвердить повторным входом
+// через внешнего провайдера.
+func writeReauthRequired(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusUnauthorized)
+	if _, err := w.Write([]byte(`{"reauthentication_required":true}`)); err != nil {
+		log.Print("writeReauthRequired: w write err: ", err.Error())
+	}
+}
+
+func (c *Controller) addLoginFailure(loginKey, ipKey string) {
+	if err := c.db.AddLoginFailure(loginKey, c.c.LoginAttempts, c.c.LoginLockout); err != nil {
+		log.Printf("addLoginFailure: %s, key: %s", err.Error(), loginKey)
+	}
+
+	if err := c.db.AddLoginFailure(ipKey, c.c.LoginIPAttempts, c.c.LoginLockout); err != nil {
+		log.Printf("addLoginFailure: %s, key: %s", err.Error(), ipKey)
+	}
 }
 
 func (c *Controller) PostOrders(w http.ResponseWriter, r *http.Request) {
@@ -124,17 +229,11 @@ func (c *Controller) PostOrders(w http.ResponseWriter, r *http.Request) {
 	var cookie cookieStruct
 	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 	if err != nil {
-		log.Print("PostRegister: unmarshal cookie err: ", err.Error())
+		log.Print("PostOrders: unmarshal cookie err: ", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if cookie.Login == "" {
-		log.Printf("PostOrders: %d, cookie: %s", http.StatusUnauthorized, cookie)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Print("PostOrders: read all err: ", err.Error())
@@ -142,35 +241,29 @@ func (c *Controller) PostOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if string(b) == "" {
+	order, ok := parseOrderNumber(b)
+	if !ok {
+		log.Printf("PostOrders: %d, cookie: %s, body: %q", http.StatusBadRequest, cookie, b)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	var order int
-	err = json.Unmarshal(b, &order)
-	if err != nil {
-		log.Print("PostOrders: json unmarshal err: ", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	err = c.db.AddOrder(cookie.Login, order)
 	if err != nil {
 		if errors.Is(err, database.ErrBadOrderNumber) {
-			log.Printf("PostOrders: %d, cookie: %s, order: %d", http.StatusUnprocessableEntity, cookie, order)
+			log.Printf("PostOrders: %d, cookie: %s, order: %s", http.StatusUnprocessableEntity, cookie, order)
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			return
 		}
 
 		if errors.Is(err, database.ErrDuplicate) {
-			log.Printf("PostOrders: %d, cookie: %s, order: %d", http.StatusOK, cookie, order)
+			log.Printf("PostOrders: %d, cookie: %s, order: %s", http.StatusOK, cookie, order)
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
 		if errors.Is(err, database.ErrUsed) {
-			log.Printf("PostOrders: %d, cookie: %s, order: %d", http.StatusConflict, cookie, order)
+			log.Printf("PostOrders: %d, cookie: %s, order: %s", http.StatusConflict, cookie, order)
 			w.WriteHeader(http.StatusConflict)
 			return
 		}
@@ -181,13 +274,103 @@ func (c *Controller) PostOrders(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go func() {
-		c.worker <- worker.OrderStr{Number: strconv.Itoa(order), Status: "NEW"}
+		c.worker <- worker.OrderStr{Number: order, Status: "NEW"}
 	}()
 
-	log.Printf("PostOrders: %d, cookie: %s, order: %d", http.StatusAccepted, cookie, order)
+	log.Printf("PostOrders: %d, cookie: %s, order: %s", http.StatusAccepted, cookie, order)
 	w.WriteHeader(http.StatusAccepted)
 }
 
+func (c *Controller) PostOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostOrdersBatch: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostOrdersBatch: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Номера принимаются и строками, и числами; каждый элемент разбирается так же, как тело PostOrders.
+	var raw []json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		log.Print("PostOrdersBatch: json unmarshal err: ", err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	var v violations
+	switch {
+	case len(raw) == 0:
+		v.add("orders", "required", "at least one order number is required")
+	case len(raw) > c.c.OrderBatchSize:
+		v.add("orders", "too_many", "at most %d order numbers per request", c.c.OrderBatchSize)
+	}
+
+	if writeViolations(w, v) {
+		log.Printf("PostOrdersBatch: %d, cookie: %s, orders: %d", http.StatusBadRequest, cookie, len(raw))
+		return
+	}
+
+	numbers := make([]string, len(raw))
+	for i, msg := range raw {
+		number, ok := parseOrderNumber(msg)
+		if !ok {
+			// Такой номер не пройдет проверку в базе и вернется с результатом invalid.
+			number = strings.TrimSpace(string(msg))
+		}
+
+		numbers[i] = number
+	}
+
+	results, err := c.db.AddOrders(cookie.Login, numbers)
+	if err != nil {
+		log.Printf("PostOrdersBatch: %s, cookie: %s, orders: %d", err.Error(), cookie, len(numbers))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var accepted []string
+	for _, result := range results {
+		if result.Result == database.OrderAccepted {
+			accepted = append(accepted, result.Number)
+		}
+	}
+
+	go func() {
+		for _, number := range accepted {
+			c.worker <- worker.OrderStr{Number: number, Status: "NEW"}
+		}
+	}()
+
+	marshal, err := json.Marshal(results)
+	if err != nil {
+		log.Print("PostOrdersBatch: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if accepted != nil {
+		status = http.StatusAccepted
+	}
+
+	log.Printf("PostOrdersBatch: %d, cookie: %s, orders: %d, accepted: %d", status, cookie, len(numbers), len(accepted))
+	w.WriteHeader(status)
+
+	if _, err = w.Write(marshal); err != nil {
+		log.Print("PostOrdersBatch: w write err: ", err.Error())
+	}
+}
+
 type withdraw struct {
 	Order string  `json:"order"`
 	Sum   float64 `json:"sum"`
@@ -199,15 +382,16 @@ func (c *Controller) PostWithDraw(w http.ResponseWriter, r *http.Request) {
 	var cookie cookieStruct
 	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
 	if err != nil {
-		log.Print("PostRegister: unmarshal cookie err: ", err.Error())
+		log.Print("PostWithDraw: unmarshal cookie err: ", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if cookie.Login == "" {
-		log.Printf("PostWithDraw: %d, cookie: %s",
-			http.StatusUnauthorized, cookie)
-		w.WriteHeader(http.StatusUnauthorized)
+	// При включенной 2FA списывать баллы можно только из сессии, прошедшей проверку второго фактора.
+	if !cookie.Verified {
+		log.Printf("PostWithDraw: %d, cookie: %s, second factor required",
+			http.StatusForbidden, cookie)
+		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
@@ -227,7 +411,15 @@ func (c *Controller) PostWithDraw(w http.ResponseWriter, r *http.Request) {
 	err = json.Unmarshal(b, &withdraw)
 	if err != nil {
 		log.Print("PostWithDraw: json unmarshal err: ", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeBadJSON(w, err)
+		return
+	}
+
+	if withdraw.Sum <= 0 {
+		var v violations
+		v.add("sum", "invalid", "sum must be positive")
+		log.Printf("PostWithDraw: %d, cookie: %s, sum: %g", http.StatusBadRequest, cookie, withdraw.Sum)
+		writeViolations(w, v)
 		return
 	}
 
@@ -257,3 +449,740 @@ func (c *Controller) PostWithDraw(w http.ResponseWriter, r *http.Request) {
 		http.StatusOK, cookie, withdraw.Order, withdraw.Sum)
 	w.WriteHeader(http.StatusOK)
 }
+
+func (c *Controller) PostLogout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostLogout: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Сессия могла быть уже завершена или истечь: выход в этом случае все равно считается успешным.
+	if cookie.SessionID != "" {
+		err = c.db.DeleteSession(cookie.ID, cookie.SessionID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			log.Printf("PostLogout: %s, cookie: %s", err.Error(), cookie)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if cookie.ID != "" {
+		c.audit(r, database.EventLogout, cookie.ID, cookie.Login, "")
+	}
+
+	c.setSessionCookies(w, "", "", time.Time{})
+	log.Printf("PostLogout: %d, cookie: %s", http.StatusOK, cookie)
+	w.WriteHeader(http.StatusOK)
+}
+
+type passwordStruct struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (c *Controller) PostPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostPassword: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostPassword: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	password := passwordStruct{}
+	if err = json.Unmarshal(b, &password); err != nil {
+		log.Printf("PostPassword: %d, cookie: %s, json unmarshal err: %s", http.StatusBadRequest, cookie, err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	// Пустой текущий пароль допустим только для аккаунта без пароля, это проверяет ChangePassword.
+	var v violations
+	validatePassword(c.c, cookie.Login, password.NewPassword, &v)
+	if writeViolations(w, v) {
+		log.Printf("PostPassword: %d, cookie: %s, violations: %v", http.StatusBadRequest, cookie, v.Errors)
+		return
+	}
+
+	// Подбор текущего пароля ограничивается теми же счетчиками, что и вход.
+	loginKey, ipKey := "login:"+cookie.Login, "ip:"+clientIP(r)
+
+	lockout, err := c.db.GetLockout(loginKey, ipKey)
+	if err != nil {
+		log.Printf("PostPassword: get lockout err: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if lockout > 0 {
+		c.audit(r, database.EventPasswordChangeFailure, cookie.ID, cookie.Login, "locked out")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+		log.Printf("PostPassword: %d, cookie: %s, retry after: %s", http.StatusTooManyRequests, cookie, lockout)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	err = c.db.ChangePassword(cookie.ID, password.CurrentPassword, password.NewPassword, cookie.recentSignIn())
+	if err != nil {
+		if errors.Is(err, database.ErrWrongData) {
+			c.addLoginFailure(loginKey, ipKey)
+			c.audit(r, database.EventPasswordChangeFailure, cookie.ID, cookie.Login, "wrong current password")
+			log.Printf("PostPassword: %d, cookie: %s", http.StatusUnauthorized, cookie)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if errors.Is(err, database.ErrReauthRequired) {
+			log.Printf("PostPassword: %d, cookie: %s, reauthentication required", http.StatusUnauthorized, cookie)
+			writeReauthRequired(w)
+			return
+		}
+
+		log.Printf("PostPassword: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = c.db.ResetLoginFailures(loginKey); err != nil {
+		log.Printf("PostPassword: reset login failures err: %s, cookie: %s", err.Error(), cookie)
+	}
+
+	if err = c.db.DeleteOtherSessions(cookie.ID, cookie.SessionID); err != nil {
+		log.Printf("PostPassword: delete other sessions err: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, database.EventPasswordChange, cookie.ID, cookie.Login, "other sessions revoked")
+	log.Printf("PostPassword: %d, cookie: %s", http.StatusOK, cookie)
+	w.WriteHeader(http.StatusOK)
+}
+
+type passwordResetStruct struct {
+	Login       string `json:"login"`
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (c *Controller) PostPasswordReset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostPasswordReset: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reset := passwordResetStruct{}
+	if err = json.Unmarshal(b, &reset); err != nil || reset.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Запросы ограничиваются так же, как попытки входа, но отдельными счетчиками: каждый запрос
+	// отправляет сообщение, и без ограничения через сброс можно было бы засыпать пользователя письмами.
+	loginKey, ipKey := "reset:login:"+reset.Login, "reset:ip:"+clientIP(r)
+
+	lockout, err := c.db.GetLockout(loginKey, ipKey)
+	if err != nil {
+		log.Printf("PostPasswordReset: get lockout err: %s, login: %s", err.Error(), reset.Login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if lockout > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+		log.Printf("PostPasswordReset: %d, login: %s, retry after: %s", http.StatusTooManyRequests, reset.Login, lockout)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	c.addLoginFailure(loginKey, ipKey)
+
+	// Ответ не зависит от существования логина и контактов, чтобы по нему нельзя было перебирать пользователей.
+	tok, target, err := c.db.AddPasswordReset(reset.Login, c.c.PasswordResetTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			log.Printf("PostPasswordReset: %d, unknown login: %s", http.StatusAccepted, reset.Login)
+			w.WriteHeader(http.StatusAccepted)
+		case errors.Is(err, database.ErrEmpty):
+			log.Printf("PostPasswordReset: %d, login: %s, no verified contact", http.StatusAccepted, reset.Login)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			log.Printf("PostPasswordReset: %s, login: %s", err.Error(), reset.Login)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = c.notifier.Notify(target, "Password reset",
+		fmt.Sprintf("Password reset token: %s (valid for %s)", tok, c.c.PasswordResetTTL))
+	if err != nil {
+		log.Printf("PostPasswordReset: notify err: %s, login: %s", err.Error(), reset.Login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostPasswordReset: %d, login: %s", http.StatusAccepted, reset.Login)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (c *Controller) PostPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostPasswordResetConfirm: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reset := passwordResetStruct{}
+	if err = json.Unmarshal(b, &reset); err != nil || reset.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userID, login, err := c.db.GetPasswordReset(reset.Token)
+	if err != nil {
+		if errors.Is(err, database.ErrWrongData) {
+			log.Printf("PostPasswordResetConfirm: %d, bad token", http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		log.Print("PostPasswordResetConfirm: get password reset err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var v violations
+	validatePassword(c.c, login, reset.NewPassword, &v)
+	if writeViolations(w, v) {
+		log.Printf("PostPasswordResetConfirm: %d, login: %s, violations: %v", http.StatusBadRequest, login, v.Errors)
+		return
+	}
+
+	err = c.db.ResetPassword(reset.Token, reset.NewPassword)
+	if err != nil {
+		if errors.Is(err, database.ErrWrongData) {
+			log.Printf("PostPasswordResetConfirm: %d, login: %s, token already used", http.StatusBadRequest, login)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("PostPasswordResetConfirm: %s, login: %s", err.Error(), login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, database.EventPasswordReset, userID, login, "all sessions revoked")
+	log.Printf("PostPasswordResetConfirm: %d, login: %s", http.StatusOK, login)
+	w.WriteHeader(http.StatusOK)
+}
+
+type twoFactorStruct struct {
+	Secret        string   `json:"secret,omitempty"`
+	URI           string   `json:"uri,omitempty"`
+	Code          string   `json:"code,omitempty"`
+	RecoveryCode  string   `json:"recovery_code,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+const recoveryCodesCount = 10
+
+func (c *Controller) PostTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostTwoFactorEnroll: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Print("PostTwoFactorEnroll: generate secret err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = c.db.SetTOTPSecret(cookie.ID, secret)
+	if err != nil {
+		if errors.Is(err, database.ErrUsed) {
+			log.Printf("PostTwoFactorEnroll: %d, cookie: %s", http.StatusConflict, cookie)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		log.Printf("PostTwoFactorEnroll: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(twoFactorStruct{Secret: secret, URI: totp.URI(c.c.TOTPIssuer, cookie.Login, secret)})
+	if err != nil {
+		log.Print("PostTwoFactorEnroll: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("PostTwoFactorEnroll: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostTwoFactorEnroll: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+func (c *Controller) PostTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostTwoFactorConfirm: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostTwoFactorConfirm: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	request := twoFactorStruct{}
+	if err = json.Unmarshal(b, &request); err != nil || request.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := c.db.GetTOTP(cookie.ID)
+	if err != nil {
+		log.Printf("PostTwoFactorConfirm: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if enabled || secret == "" {
+		log.Printf("PostTwoFactorConfirm: %d, cookie: %s, enabled: %t", http.StatusConflict, cookie, enabled)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.ValidateStep(secret, request.Code, time.Now())
+	if !ok {
+		log.Printf("PostTwoFactorConfirm: %d, cookie: %s, bad code", http.StatusUnprocessableEntity, cookie)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err = c.db.UseTOTPStep(cookie.ID, step); err != nil {
+		if errors.Is(err, database.ErrUsed) {
+			log.Printf("PostTwoFactorConfirm: %d, cookie: %s, code reused", http.StatusUnprocessableEntity, cookie)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		log.Printf("PostTwoFactorConfirm: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := totp.RecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		log.Print("PostTwoFactorConfirm: recovery codes err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = c.db.EnableTOTP(cookie.ID, cookie.SessionID, codes); err != nil {
+		log.Printf("PostTwoFactorConfirm: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(twoFactorStruct{RecoveryCodes: codes})
+	if err != nil {
+		log.Print("PostTwoFactorConfirm: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("PostTwoFactorConfirm: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostTwoFactorConfirm: %d, cookie: %s", http.StatusOK, cookie)
+}
+
+func (c *Controller) PostTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostTwoFactorVerify: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostTwoFactorVerify: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	request := twoFactorStruct{}
+	if err = json.Unmarshal(b, &request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := c.db.GetTOTP(cookie.ID)
+	if err != nil {
+		log.Printf("PostTwoFactorVerify: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !enabled {
+		log.Printf("PostTwoFactorVerify: %d, cookie: %s, 2fa disabled", http.StatusConflict, cookie)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	loginKey, ipKey := "login:"+cookie.Login, "ip:"+clientIP(r)
+
+	lockout, err := c.db.GetLockout(loginKey, ipKey)
+	if err != nil {
+		log.Printf("PostTwoFactorVerify: get lockout err: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if lockout > 0 {
+		c.audit(r, database.EventLoginFailure, cookie.ID, cookie.Login, "second factor locked out")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+		log.Printf("PostTwoFactorVerify: %d, cookie: %s, retry after: %s", http.StatusTooManyRequests, cookie, lockout)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	ok, err := c.checkSecondFactor(cookie.ID, secret, request.Code, request.RecoveryCode)
+	if err != nil {
+		log.Printf("PostTwoFactorVerify: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		c.addLoginFailure(loginKey, ipKey)
+		c.audit(r, database.EventLoginFailure, cookie.ID, cookie.Login, "wrong second factor")
+		log.Printf("PostTwoFactorVerify: %d, cookie: %s, bad code", http.StatusUnauthorized, cookie)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if err = c.db.SetSessionMFA(cookie.SessionID); err != nil {
+		log.Printf("PostTwoFactorVerify: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = c.db.ResetLoginFailures(loginKey); err != nil {
+		log.Printf("PostTwoFactorVerify: reset login failures err: %s, cookie: %s", err.Error(), cookie)
+	}
+
+	c.audit(r, database.EventLoginSuccess, cookie.ID, cookie.Login, "second factor verified")
+	log.Printf("PostTwoFactorVerify: %d, cookie: %s", http.StatusOK, cookie)
+	w.WriteHeader(http.StatusOK)
+}
+
+type apiKeyStruct struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (c *Controller) PostAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostAPIKey: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostAPIKey: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	request := apiKeyStruct{}
+	if err = json.Unmarshal(b, &request); err != nil || request.Name == "" || len(request.Scopes) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range request.Scopes {
+		if !scopes[scope] {
+			log.Printf("PostAPIKey: %d, cookie: %s, unknown scope: %s", http.StatusBadRequest, cookie, scope)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, err := c.db.AddAPIKey(cookie.ID, request.Name, request.Scopes)
+	if err != nil {
+		log.Printf("PostAPIKey: %s, cookie: %s", err.Error(), cookie)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(key)
+	if err != nil {
+		log.Print("PostAPIKey: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		log.Print("PostAPIKey: w write err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostAPIKey: %d, cookie: %s, key: %s, scopes: %v", http.StatusOK, cookie, key.ID, key.Scopes)
+}
+
+type contactCodeStruct struct {
+	Code string `json:"code"`
+}
+
+func (c *Controller) PostContactVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostContactVerify: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	channel := chi.URLParam(r, "channel")
+
+	target, code, err := c.db.AddContactCode(cookie.ID, channel, c.c.ContactCodeTTL, c.c.ContactCodeCooldown,
+		c.c.ContactCodeDaily)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRateLimited):
+			delay, err := c.db.GetContactCodeDelay(cookie.ID, channel, c.c.ContactCodeCooldown, c.c.ContactCodeDaily)
+			if err != nil {
+				log.Printf("PostContactVerify: %s, cookie: %s, channel: %s", err.Error(), cookie, channel)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			log.Printf("PostContactVerify: %d, cookie: %s, channel: %s, retry after: %s", http.StatusTooManyRequests,
+				cookie, channel, delay)
+			w.WriteHeader(http.StatusTooManyRequests)
+		case errors.Is(err, database.ErrWrongData):
+			log.Printf("PostContactVerify: %d, cookie: %s, channel: %s", http.StatusNotFound, cookie, channel)
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, database.ErrEmpty):
+			var v violations
+			v.add(channel, "required", "%s is not set in the profile", channel)
+			log.Printf("PostContactVerify: %d, cookie: %s, channel: %s", http.StatusBadRequest, cookie, channel)
+			writeViolations(w, v)
+		case errors.Is(err, database.ErrUsed):
+			log.Printf("PostContactVerify: %d, cookie: %s, channel: %s", http.StatusConflict, cookie, channel)
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Printf("PostContactVerify: %s, cookie: %s, channel: %s", err.Error(), cookie, channel)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = c.notifier.Notify(target, "Contact verification",
+		fmt.Sprintf("Verification code: %s (valid for %s)", code, c.c.ContactCodeTTL))
+	if err != nil {
+		log.Printf("PostContactVerify: notify err: %s, cookie: %s, channel: %s", err.Error(), cookie, channel)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostContactVerify: %d, cookie: %s, channel: %s", http.StatusAccepted, cookie, channel)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (c *Controller) PostContactConfirm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostContactConfirm: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	channel := chi.URLParam(r, "channel")
+	if channel != database.ChannelEmail && channel != database.ChannelPhone {
+		log.Printf("PostContactConfirm: %d, cookie: %s, channel: %s", http.StatusNotFound, cookie, channel)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostContactConfirm: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	code := contactCodeStruct{}
+	if err = json.Unmarshal(b, &code); err != nil {
+		log.Printf("PostContactConfirm: %d, cookie: %s, json unmarshal err: %s", http.StatusBadRequest, cookie, err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	err = c.db.ConfirmContact(cookie.ID, channel, code.Code)
+	if err != nil {
+		if errors.Is(err, database.ErrWrongData) {
+			var v violations
+			v.add("code", "invalid", "verification code is wrong or expired")
+			log.Printf("PostContactConfirm: %d, cookie: %s, channel: %s", http.StatusBadRequest, cookie, channel)
+			writeViolations(w, v)
+			return
+		}
+
+		log.Printf("PostContactConfirm: %s, cookie: %s, channel: %s", err.Error(), cookie, channel)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostContactConfirm: %d, cookie: %s, channel: %s", http.StatusOK, cookie, channel)
+	w.WriteHeader(http.StatusOK)
+}
+
+type adjustmentStruct struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+func (c *Controller) PostAdjustment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PostAdjustment: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	number, ok := parseOrderNumber([]byte(chi.URLParam(r, "number")))
+	if !ok {
+		log.Printf("PostAdjustment: %d, cookie: %s, order: %s", http.StatusBadRequest, cookie, chi.URLParam(r, "number"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PostAdjustment: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	adjustment := adjustmentStruct{}
+	if err = json.Unmarshal(b, &adjustment); err != nil {
+		log.Printf("PostAdjustment: %d, cookie: %s, json unmarshal err: %s", http.StatusBadRequest, cookie, err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	// Отрицательная сумма списывает баллы (возврат, чарджбэк), положительная - доначисляет.
+	var v violations
+	if adjustment.Amount == 0 || math.IsNaN(adjustment.Amount) || math.IsInf(adjustment.Amount, 0) {
+		v.add("amount", "invalid", "amount must be a non-zero number")
+	}
+
+	adjustment.Reason = strings.TrimSpace(adjustment.Reason)
+	if adjustment.Reason == "" {
+		v.add("reason", "required", "reason is required")
+	}
+
+	if writeViolations(w, v) {
+		log.Printf("PostAdjustment: %d, cookie: %s, order: %s", http.StatusBadRequest, cookie, number)
+		return
+	}
+
+	a, err := c.db.AddAdjustment(number, adjustment.Amount, adjustment.Reason, cookie.Login)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("PostAdjustment: %d, cookie: %s, order: %s", http.StatusNotFound, cookie, number)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, database.ErrNotProcessed) {
+			log.Printf("PostAdjustment: %d, cookie: %s, order: %s", http.StatusConflict, cookie, number)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		log.Printf("PostAdjustment: %s, cookie: %s, order: %s", err.Error(), cookie, number)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	marshal, err := json.Marshal(a)
+	if err != nil {
+		log.Print("PostAdjustment: json marshal err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PostAdjustment: %d, cookie: %s, order: %s, amount: %g", http.StatusCreated, cookie, number, a.Amount)
+	w.WriteHeader(http.StatusCreated)
+
+	if _, err = w.Write(marshal); err != nil {
+		log.Print("PostAdjustment: w write err: ", err.Error())
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
+	"github.com/go-chi/chi/v5"
+)
+
+type roleStruct struct {
+	Role string `json:"role"`
+}
+
+func (c *Controller) PutUserRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cookie cookieStruct
+	err := json.Unmarshal([]byte(fmt.Sprintf("%s", r.Context().Value(identification))), &cookie)
+	if err != nil {
+		log.Print("PutUserRole: unmarshal cookie err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	login := chi.URLParam(r, "login")
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print("PutUserRole: read all err: ", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	role := roleStruct{}
+	if err = json.Unmarshal(b, &role); err != nil {
+		log.Printf("PutUserRole: %d, cookie: %s, json unmarshal err: %s", http.StatusBadRequest, cookie, err.Error())
+		writeBadJSON(w, err)
+		return
+	}
+
+	// Администратор не может снять роль с самого себя, чтобы не оставить сервис без администраторов.
+	if login == cookie.Login && role.Role != database.RoleAdmin {
+		log.Printf("PutUserRole: %d, cookie: %s, role: %s", http.StatusConflict, cookie, role.Role)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	err = c.db.SetRole(login, role.Role)
+	if err != nil {
+		if errors.Is(err, database.ErrWrongData) {
+			var v violations
+			v.add("role", "invalid", "role must be one of: %s, %s, %s",
+				database.RoleUser, database.RoleSupport, database.RoleAdmin)
+			log.Printf("PutUserRole: %d, cookie: %s, role: %s", http.StatusBadRequest, cookie, role.Role)
+			writeViolations(w, v)
+			return
+		}
+
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("PutUserRole: %d, cookie: %s, login: %s", http.StatusNotFound, cookie, login)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Printf("PutUserRole: %s, cookie: %s, login: %s", err.Error(), cookie, login)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PutUserRole: %d, cookie: %s, login: %s, role: %s", http.StatusOK, cookie, login, role.Role)
+	w.WriteHeader(http.StatusOK)
+}
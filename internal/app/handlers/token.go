@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	errBadToken     = errors.New("bad token")
+	errTokenExpired = errors.New("token expired")
+)
+
+// token - содержимое подписанного токена сессии: <base64(json)>.<base64(hmac-sha256)>.
+type token struct {
+	SessionID string `json:"sid"`
+	UserID    string `json:"uid"`
+	Login     string `json:"login"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c *Controller) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(c.c.SecretKey))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Controller) makeToken(sessionID, userID, login string, expiresAt time.Time) (string, error) {
+	b, err := json.Marshal(token{
+		SessionID: sessionID,
+		UserID:    userID,
+		Login:     login,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	return payload + "." + c.sign(payload), nil
+}
+
+func (c *Controller) parseToken(s string) (token, error) {
+	payload, signature, ok := strings.Cut(s, ".")
+	if !ok {
+		return token{}, errBadToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(c.sign(payload))) {
+		return token{}, errBadToken
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return token{}, errBadToken
+	}
+
+	var t token
+	if err = json.Unmarshal(b, &t); err != nil {
+		return token{}, errBadToken
+	}
+
+	if t.SessionID == "" || t.UserID == "" || t.Login == "" {
+		return token{}, errBadToken
+	}
+
+	if time.Now().Unix() >= t.ExpiresAt {
+		return token{}, errTokenExpired
+	}
+
+	return t, nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+func TestToken(t *testing.T) {
+	c := NewController(config.Config{SecretKey: "secret"}, nil, nil, nil)
+
+	tok, err := c.makeToken("session", "1", "username", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("makeToken() error = %v", err)
+	}
+
+	expiredTok, err := c.makeToken("session", "1", "username", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("makeToken() error = %v", err)
+	}
+
+	other := NewController(config.Config{SecretKey: "other"}, nil, nil, nil)
+	otherTok, err := other.makeToken("session", "1", "username", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("makeToken() error = %v", err)
+	}
+
+	payload, signature, _ := strings.Cut(tok, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{
+			name:    "Действительный токен",
+			token:   tok,
+			wantErr: nil,
+		},
+		{
+			name:    "Просроченный токен",
+			token:   expiredTok,
+			wantErr: errTokenExpired,
+		},
+		{
+			name:    "Чужой ключ",
+			token:   otherTok,
+			wantErr: errBadToken,
+		},
+		{
+			name:    "Измененные данные",
+			token:   payload + "a." + signature,
+			wantErr: errBadToken,
+		},
+		{
+			name:    "Без подписи",
+			token:   payload,
+			wantErr: errBadToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.parseToken(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (got.SessionID != "session" || got.UserID != "1" || got.Login != "username") {
+				t.Errorf("parseToken() got = %v", got)
+			}
+		})
+	}
+}
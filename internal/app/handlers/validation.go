@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+// bcrypt учитывает только первые 72 байта пароля.
+const maxPasswordBytes = 72
+
+// deletedLoginPrefix занят обезличенными удаленными учетными записями.
+const deletedLoginPrefix = "deleted-"
+
+// violation - одно нарушение политики, возвращается клиенту в теле ответа 400.
+type violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type violations struct {
+	Errors []violation `json:"errors"`
+}
+
+func (v *violations) add(field, code, format string, a ...any) {
+	v.Errors = append(v.Errors, violation{Field: field, Code: code, Message: fmt.Sprintf(format, a...)})
+}
+
+func isLoginRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-@", r))
+}
+
+// validateLogin проверяет логин новой учетной записи.
+func validateLogin(c config.Config, login string, v *violations) {
+	n := utf8.RuneCountInString(login)
+	switch {
+	case n == 0:
+		v.add("login", "required", "login is required")
+		return
+	case n < c.LoginMinLength:
+		v.add("login", "too_short", "login must be at least %d characters", c.LoginMinLength)
+	case n > c.LoginMaxLength:
+		v.add("login", "too_long", "login must be at most %d characters", c.LoginMaxLength)
+	}
+
+	for _, r := range login {
+		if !isLoginRune(r) {
+			v.add("login", "invalid_characters", "login may contain only latin letters, digits and . _ - @")
+			break
+		}
+	}
+
+	lower := strings.ToLower(login)
+	if strings.HasPrefix(lower, deletedLoginPrefix) {
+		v.add("login", "reserved", "login is reserved")
+		return
+	}
+
+	for _, reserved := range c.ReservedLogins {
+		if lower == strings.ToLower(strings.TrimSpace(reserved)) {
+			v.add("login", "reserved", "login is reserved")
+			return
+		}
+	}
+}
+
+// validatePassword проверяет новый пароль на соответствие парольной политике.
+func validatePassword(c config.Config, login, pass string, v *violations) {
+	if pass == "" {
+		v.add("password", "required", "password is required")
+		return
+	}
+
+	if utf8.RuneCountInString(pass) < c.PasswordMinLength {
+		v.add("password", "too_short", "password must be at least %d characters", c.PasswordMinLength)
+	}
+
+	if len(pass) > maxPasswordBytes {
+		v.add("password", "too_long", "password must be at most %d bytes", maxPasswordBytes)
+	}
+
+	var lower, upper, digit, other int
+	for _, r := range pass {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	if lower+upper+digit+other < c.PasswordClasses {
+		v.add("password", "too_weak",
+			"password must contain at least %d of: lowercase letters, uppercase letters, digits, other characters",
+			c.PasswordClasses)
+	}
+
+	if login != "" && strings.EqualFold(pass, login) {
+		v.add("password", "same_as_login", "password must differ from login")
+	}
+}
+
+// phonePattern - номер телефона в формате E.164.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// validateEmail проверяет адрес электронной почты. Пустая строка означает удаление адреса.
+func validateEmail(email string, v *violations) {
+	if email == "" {
+		return
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		v.add("email", "invalid", "email must be a plain address like user@example.com")
+	}
+}
+
+// validatePhone проверяет номер телефона. Пустая строка означает удаление номера.
+func validatePhone(phone string, v *violations) {
+	if phone != "" && !phonePattern.MatchString(phone) {
+		v.add("phone", "invalid", "phone must be in international format like +79991234567")
+	}
+}
+
+// parseOrderNumber достает номер заказа из тела text/plain. Номер остается строкой: он может быть длиннее
+// int64 и начинаться с нулей. Для совместимости со старыми клиентами принимается и JSON-строка в кавычках.
+// Проверка контрольной цифры остается за базой данных, здесь отсекается только неверный формат.
+func parseOrderNumber(b []byte) (string, bool) {
+	s := strings.TrimSpace(string(b))
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal([]byte(s), &s); err != nil {
+			return "", false
+		}
+	}
+
+	if s == "" {
+		return "", false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+
+	return s, true
+}
+
+// writeViolations отвечает 400 со списком нарушений, если они есть.
+func writeViolations(w http.ResponseWriter, v violations) bool {
+	if len(v.Errors) == 0 {
+		return false
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+
+	marshal, err := json.Marshal(v)
+	if err != nil {
+		log.Print("writeViolations: json marshal err: ", err.Error())
+		return true
+	}
+
+	if _, err = w.Write(marshal); err != nil {
+		log.Print("writeViolations: w write err: ", err.Error())
+	}
+
+	return true
+}
+
+// writeBadJSON отвечает 400 на тело запроса, которое не удалось разобрать.
+func writeBadJSON(w http.ResponseWriter, err error) {
+	var v violations
+	v.add("body", "malformed", "request body must be a valid JSON object: %s", err.Error())
+	writeViolations(w, v)
+}
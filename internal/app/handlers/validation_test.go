@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+var testPolicy = config.Config{
+	LoginMinLength:    3,
+	LoginMaxLength:    16,
+	PasswordMinLength: 8,
+	PasswordClasses:   2,
+	ReservedLogins:    []string{"admin", "root"},
+}
+
+func codes(v violations) []string {
+	var c []string
+	for _, e := range v.Errors {
+		c = append(c, e.Code)
+	}
+	return c
+}
+
+func TestValidateLogin(t *testing.T) {
+	tests := []struct {
+		name  string
+		login string
+		want  []string
+	}{
+		{
+			name:  "Пустой логин",
+			login: "",
+			want:  []string{"required"},
+		},
+		{
+			name:  "Короткий логин",
+			login: "ab",
+			want:  []string{"too_short"},
+		},
+		{
+			name:  "Длинный логин",
+			login: "abcdefghijklmnopq",
+			want:  []string{"too_long"},
+		},
+		{
+			name:  "Недопустимые символы",
+			login: "user name",
+			want:  []string{"invalid_characters"},
+		},
+		{
+			name:  "Кириллица",
+			login: "пользователь",
+			want:  []string{"invalid_characters"},
+		},
+		{
+			name:  "Зарезервированный логин",
+			login: "Admin",
+			want:  []string{"reserved"},
+		},
+		{
+			name:  "Логин удаленной учетной записи",
+			login: "deleted-1",
+			want:  []string{"reserved"},
+		},
+		{
+			name:  "Подходящий логин",
+			login: "user.name@shop",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v violations
+			validateLogin(testPolicy, tt.login, &v)
+			if got := codes(v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateLogin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name  string
+		login string
+		pass  string
+		want  []string
+	}{
+		{
+			name:  "Пустой пароль",
+			login: "username",
+			pass:  "",
+			want:  []string{"required"},
+		},
+		{
+			name:  "Короткий пароль",
+			login: "username",
+			pass:  "pass1",
+			want:  []string{"too_short"},
+		},
+		{
+			name:  "Длинный пароль",
+			login: "username",
+			pass:  "password1password1password1password1password1password1password1password1password1",
+			want:  []string{"too_long"},
+		},
+		{
+			name:  "Слабый пароль",
+			login: "username",
+			pass:  "correcthorse",
+			want:  []string{"too_weak"},
+		},
+		{
+			name:  "Пароль совпадает с логином",
+			login: "username1",
+			pass:  "UserName1",
+			want:  []string{"same_as_login"},
+		},
+		{
+			name:  "Подходящий пароль",
+			login: "username",
+			pass:  "correct horse",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v violations
+			validatePassword(testPolicy, tt.login, tt.pass, &v)
+			if got := codes(v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validatePassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateContacts(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		phone string
+		want  []string
+	}{
+		{
+			name: "Удаление контактов",
+			want: nil,
+		},
+		{
+			name:  "Корректные контакты",
+			email: "user@example.com",
+			phone: "+79991234567",
+			want:  nil,
+		},
+		{
+			name:  "Адрес с именем",
+			email: "User <user@example.com>",
+			want:  []string{"invalid"},
+		},
+		{
+			name:  "Адрес без домена",
+			email: "user",
+			want:  []string{"invalid"},
+		},
+		{
+			name:  "Телефон без кода страны",
+			phone: "89991234567",
+			want:  []string{"invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v violations
+			validateEmail(tt.email, &v)
+			validatePhone(tt.phone, &v)
+			if got := codes(v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateEmail(), validatePhone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOrderNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "text/plain",
+			body:   "49927398716",
+			want:   "49927398716",
+			wantOk: true,
+		},
+		{
+			name:   "Перевод строки и ведущие нули",
+			body:   "0049927398716\n",
+			want:   "0049927398716",
+			wantOk: true,
+		},
+		{
+			name:   "Длиннее int64",
+			body:   "12345678123456781234567812345672",
+			want:   "12345678123456781234567812345672",
+			wantOk: true,
+		},
+		{
+			name:   "JSON-строка",
+			body:   `"49927398716"`,
+			want:   "49927398716",
+			wantOk: true,
+		},
+		{
+			name:   "Пустое тело",
+			body:   " \n",
+			wantOk: false,
+		},
+		{
+			name:   "Не цифры",
+			body:   "4992-7398716",
+			wantOk: false,
+		},
+		{
+			name:   "JSON-объект",
+			body:   `{"order":"49927398716"}`,
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseOrderNumber([]byte(tt.body))
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseOrderNumber() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package notifier
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+// Notifier доставляет пользователю служебные сообщения: токены сброса пароля, коды подтверждения и т.п.
+type Notifier interface {
+	Notify(to, subject, text string) error
+}
+
+// NewNotifier выбирает способ доставки по конфигурации. Если доставка не настроена, возвращается nil:
+// токены сброса пароля и коды подтверждения не должны попадать в логи, поэтому сервер не открывает
+// маршруты, которые их отправляют.
+func NewNotifier(c config.Config) Notifier {
+	if c.NotifierFile != "" {
+		return NewFileNotifier(c.NotifierFile)
+	}
+
+	return nil
+}
+
+// FileNotifier дописывает сообщения в файл, по одному на строку.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(to, subject, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), to, subject, text)
+	return err
+}
@@ -0,0 +1,35 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.log")
+	n := NewFileNotifier(path)
+
+	if err := n.Notify("username", "subject 1", "text 1"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if err := n.Notify("username", "subject 2", "text 2"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Notify() wrote %d lines, want 2", len(lines))
+	}
+
+	if !strings.HasSuffix(lines[1], "\tusername\tsubject 2\ttext 2") {
+		t.Errorf("Notify() line = %q", lines[1])
+	}
+}
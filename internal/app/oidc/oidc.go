@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+var (
+	ErrExchange   = errors.New("oidc: code exchange failed")
+	ErrBadIDToken = errors.New("oidc: bad id token")
+)
+
+// Claims - утверждения ID-токена, которые нужны для входа.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Audience          any    `json:"aud"` // строка или массив строк
+	ExpiresAt         int64  `json:"exp"`
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// Provider реализует вход по authorization code flow с PKCE у одного провайдера.
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+}
+
+// NewProvider возвращает провайдера из конфигурации или nil, если вход через OIDC не настроен.
+func NewProvider(c config.Config) *Provider {
+	if c.OIDCIssuer == "" {
+		return nil
+	}
+
+	return &Provider{
+		issuer:       strings.TrimSuffix(c.OIDCIssuer, "/"),
+		clientID:     c.OIDCClientID,
+		clientSecret: c.OIDCClientSecret,
+		redirectURL:  c.OIDCRedirectURL,
+		scopes:       c.OIDCScopes,
+		client:       &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Issuer возвращает идентификатор провайдера, под которым хранятся привязанные учетные записи.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// getDiscovery загружает и кеширует метаданные провайдера. При ошибке следующий вызов повторит запрос.
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery status %d", resp.StatusCode)
+	}
+
+	var d discovery
+	if err = json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+
+	// Подпись ID-токена не проверяется: токен получен напрямую от провайдера, поэтому канал
+	// обязан быть защищен TLS.
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer || !isHTTPS(d.AuthorizationEndpoint) || !isHTTPS(d.TokenEndpoint) {
+		return nil, errors.New("oidc: bad discovery document")
+	}
+
+	p.discovery = &d
+
+	return p.discovery, nil
+}
+
+// AuthURL возвращает адрес страницы входа провайдера.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.clientID)
+	v.Set("redirect_uri", p.redirectURL)
+	v.Set("scope", strings.Join(p.scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на ID-токен и проверяет его утверждения.
+// ID-токен получен напрямую от token endpoint провайдера по TLS, поэтому, как допускает
+// OpenID Connect Core 3.1.3.7, подлинность эмитента подтверждается TLS, а не подписью токена.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.redirectURL)
+	v.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("%w: status %d: %s", ErrExchange, resp.StatusCode, b)
+	}
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.Unmarshal(b, &tok); err != nil || tok.IDToken == "" {
+		return Claims{}, fmt.Errorf("%w: no id_token", ErrExchange)
+	}
+
+	return p.parseIDToken(tok.IDToken, nonce, time.Now())
+}
+
+func (p *Provider) parseIDToken(idToken, nonce string, now time.Time) (Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrBadIDToken
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrBadIDToken
+	}
+
+	var claims Claims
+	if err = json.Unmarshal(b, &claims); err != nil {
+		return Claims{}, ErrBadIDToken
+	}
+
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer:
+		return Claims{}, fmt.Errorf("%w: issuer %s", ErrBadIDToken, claims.Issuer)
+	case !claims.hasAudience(p.clientID):
+		return Claims{}, fmt.Errorf("%w: audience", ErrBadIDToken)
+	case claims.Subject == "":
+		return Claims{}, fmt.Errorf("%w: no subject", ErrBadIDToken)
+	case now.Unix() >= claims.ExpiresAt:
+		return Claims{}, fmt.Errorf("%w: expired", ErrBadIDToken)
+	case claims.Nonce != nonce:
+		return Claims{}, fmt.Errorf("%w: nonce", ErrBadIDToken)
+	}
+
+	return claims, nil
+}
+
+func (c Claims) hasAudience(clientID string) bool {
+	switch aud := c.Audience.(type) {
+	case string:
+		return aud == clientID
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isHTTPS сообщает, что s - абсолютный https URL.
+func isHTTPS(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// RandomString возвращает случайное значение для state, nonce и PKCE verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
+)
+
+// stubIdP - минимальный провайдер OpenID Connect: discovery, страница входа и token endpoint.
+type stubIdP struct {
+	*httptest.Server
+	claims    map[string]any
+	challenge string
+	nonce     string
+	tokenURL  string // token_endpoint в discovery, если отличается от стандартного
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	idp := &stubIdP{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		tokenURL := idp.URL + "/token"
+		if idp.tokenURL != "" {
+			tokenURL = idp.tokenURL
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         tokenURL,
+		})
+	})
+
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		idp.challenge = r.URL.Query().Get("code_challenge")
+		idp.nonce = r.URL.Query().Get("nonce")
+		http.Redirect(w, r, r.URL.Query().Get("redirect_uri")+"?code=code&state="+r.URL.Query().Get("state"),
+			http.StatusFound)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || id != "gophermart" || secret != "secret" || r.PostFormValue("code") != "code" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		claims := map[string]any{
+			"iss":                idp.URL,
+			"sub":                "subject",
+			"aud":                "gophermart",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"nonce":              idp.nonce,
+			"preferred_username": "username",
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+
+		payload, _ := json.Marshal(claims)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token": base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." +
+				base64.RawURLEncoding.EncodeToString(payload) + ".signature",
+		})
+	})
+
+	idp.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// login проходит страницу входа stub-провайдера и возвращает выданный код.
+func (idp *stubIdP) login(t *testing.T, authURL string) string {
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize err: %v", err)
+	}
+
+	_ = resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse location err: %v", err)
+	}
+
+	return location.Query().Get("code")
+}
+
+func TestProvider(t *testing.T) {
+	idp := newStubIdP(t)
+
+	p := NewProvider(config.Config{
+		OIDCIssuer:       idp.URL,
+		OIDCClientID:     "gophermart",
+		OIDCClientSecret: "secret",
+		OIDCRedirectURL:  "http://localhost/api/user/oidc/callback",
+		OIDCScopes:       []string{"openid", "profile"},
+	})
+	p.client = idp.Client()
+
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		verifier string
+		nonce    string
+		wantErr  error
+	}{
+		{
+			name:    "Успешный вход",
+			wantErr: nil,
+		},
+		{
+			name:    "Аудитория массивом",
+			claims:  map[string]any{"aud": []string{"other", "gophermart"}},
+			wantErr: nil,
+		},
+		{
+			name:    "Чужая аудитория",
+			claims:  map[string]any{"aud": "other"},
+			wantErr: ErrBadIDToken,
+		},
+		{
+			name:    "Чужой эмитент",
+			claims:  map[string]any{"iss": "https://evil.example"},
+			wantErr: ErrBadIDToken,
+		},
+		{
+			name:    "Истекший токен",
+			claims:  map[string]any{"exp": time.Now().Add(-time.Minute).Unix()},
+			wantErr: ErrBadIDToken,
+		},
+		{
+			name:    "Другой nonce",
+			nonce:   "other",
+			wantErr: ErrBadIDToken,
+		},
+		{
+			name:     "Неверный PKCE verifier",
+			verifier: "other",
+			wantErr:  ErrExchange,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims = tt.claims
+
+			verifier, _ := RandomString()
+			authURL, err := p.AuthURL(context.Background(), "state", "nonce", verifier)
+			if err != nil {
+				t.Fatalf("AuthURL() error = %v", err)
+			}
+
+			code := idp.login(t, authURL)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			got, err := p.Exchange(context.Background(), code, verifier, nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (got.Subject != "subject" || got.PreferredUsername != "username") {
+				t.Errorf("Exchange() got = %v", got)
+			}
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if p := NewProvider(config.Config{}); p != nil {
+		t.Errorf("NewProvider() = %v, want nil without issuer", p)
+	}
+}
+
+func TestDiscoveryHTTPS(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.tokenURL = "http://" + idp.Listener.Addr().String() + "/token"
+
+	p := NewProvider(config.Config{OIDCIssuer: idp.URL, OIDCClientID: "gophermart"})
+	p.client = idp.Client()
+
+	if _, err := p.AuthURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Errorf("AuthURL() error = %v, want error for http token endpoint", err)
+	}
+}
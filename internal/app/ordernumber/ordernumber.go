@@ -0,0 +1,144 @@
+package ordernumber
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validator проверяет номер заказа. Номер - строка из цифр, ведущие нули значимы.
+type Validator interface {
+	Valid(number string) bool
+}
+
+// Luhn - проверка контрольной цифры алгоритмом Луна, схема по умолчанию.
+type Luhn struct{}
+
+var sumOfElementsOfADoubleNumber = [...]int{0, 2, 4, 6, 8, 1, 3, 5, 7, 9}
+
+func (Luhn) Valid(number string) bool {
+	if !digits(number) {
+		return false
+	}
+
+	odd := len(number) & 1
+	var sum int
+	for i, c := range number {
+		if i&1 == odd {
+			sum += sumOfElementsOfADoubleNumber[c-'0']
+		} else {
+			sum += int(c - '0')
+		}
+	}
+
+	return sum%10 == 0
+}
+
+// Mod11 - контрольная цифра по модулю 11 с весами 2..7 справа налево. Номера, для которых контрольная
+// цифра получилась бы равной 10, не выпускаются и считаются неверными.
+type Mod11 struct{}
+
+func (Mod11) Valid(number string) bool {
+	if len(number) < 2 || !digits(number) {
+		return false
+	}
+
+	payload, check := number[:len(number)-1], int(number[len(number)-1]-'0')
+
+	var sum int
+	for i := 0; i < len(payload); i++ {
+		sum += int(payload[len(payload)-1-i]-'0') * (2 + i%6)
+	}
+
+	return (11-sum%11)%11 == check
+}
+
+// schemes - схемы, которые можно указать в настройках.
+var schemes = map[string]Validator{
+	"luhn":  Luhn{},
+	"mod11": Mod11{},
+}
+
+type rule struct {
+	prefix    string
+	validator Validator
+}
+
+// ByPrefix выбирает схему по самому длинному совпавшему префиксу номера, остальные номера проверяет
+// схемой по умолчанию.
+type ByPrefix struct {
+	def   Validator
+	rules []rule
+}
+
+// New собирает валидатор из правил вида "префикс=схема", например "77=mod11". Префикс "*" меняет
+// схему по умолчанию (Luhn). Без правил валидатор проверяет все номера алгоритмом Луна.
+func New(spec []string) (*ByPrefix, error) {
+	v := &ByPrefix{def: Luhn{}}
+	seen := map[string]bool{}
+	for _, s := range spec {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		prefix, name, ok := strings.Cut(s, "=")
+		prefix, name = strings.TrimSpace(prefix), strings.ToLower(strings.TrimSpace(name))
+
+		validator, known := schemes[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("order validator %q: want prefix=scheme with scheme one of luhn, mod11", s)
+		}
+
+		if seen[prefix] {
+			return nil, fmt.Errorf("order validator %q: duplicate prefix", s)
+		}
+
+		seen[prefix] = true
+
+		if prefix == "*" {
+			v.def = validator
+			continue
+		}
+
+		if !digits(prefix) {
+			return nil, fmt.Errorf("order validator %q: prefix must be digits", s)
+		}
+
+		v.rules = append(v.rules, rule{prefix: prefix, validator: validator})
+	}
+
+	sort.Slice(v.rules, func(i, j int) bool {
+		return len(v.rules[i].prefix) > len(v.rules[j].prefix)
+	})
+
+	return v, nil
+}
+
+func (v *ByPrefix) Valid(number string) bool {
+	if !digits(number) {
+		return false
+	}
+
+	for _, r := range v.rules {
+		if strings.HasPrefix(number, r.prefix) {
+			return r.validator.Valid(number)
+		}
+	}
+
+	return v.def.Valid(number)
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,119 @@
+package ordernumber
+
+import (
+	"testing"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want bool
+	}{
+		{
+			name: "",
+			args: "01",
+			want: false,
+		},
+		{
+			name: "",
+			args: "49927398716",
+			want: true,
+		},
+		{
+			name: "",
+			args: "1234567812345670",
+			want: true,
+		},
+		{
+			name: "Ведущие нули",
+			args: "0049927398716",
+			want: true,
+		},
+		{
+			name: "Длиннее int64",
+			args: "12345678123456781234567812345672",
+			want: true,
+		},
+		{
+			name: "Пустой номер",
+			args: "",
+			want: false,
+		},
+		{
+			name: "Не цифры",
+			args: "4992739871a",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Luhn{}).Valid(tt.args); got != tt.want {
+				t.Errorf("Luhn.Valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMod11(t *testing.T) {
+	tests := []struct {
+		args string
+		want bool
+	}{
+		{args: "1234567892", want: true},
+		{args: "1234567893", want: false},
+		{args: "77000000011", want: true},
+		{args: "7", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			if got := (Mod11{}).Valid(tt.args); got != tt.want {
+				t.Errorf("Mod11.Valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByPrefix(t *testing.T) {
+	v, err := New([]string{"77=mod11", " 770 = luhn "})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want bool
+	}{
+		{name: "Схема по умолчанию", args: "49927398716", want: true},
+		{name: "Не Луна по умолчанию", args: "1234567892", want: false},
+		{name: "Префикс mod11", args: "77100000019", want: true},
+		{name: "Луна под префиксом mod11", args: "7712345678901", want: false},
+		{name: "Более длинный префикс", args: "7701234567895", want: true},
+		{name: "Не цифры", args: "77-0000000011", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Valid(tt.args); got != tt.want {
+				t.Errorf("ByPrefix.Valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, spec := range [][]string{{"77"}, {"77=crc"}, {"7a=luhn"}, {"77=luhn", "77=mod11"}} {
+		if _, err := New(spec); err == nil {
+			t.Errorf("New(%q) error = nil, want error", spec)
+		}
+	}
+
+	v, err := New([]string{"*=mod11"})
+	if err != nil {
+		t.Fatalf("New() error = %v, wantErr %v", err, false)
+	}
+
+	if !v.Valid("1234567892") || v.Valid("49927398716") {
+		t.Errorf("New() with default scheme override: valid = %v, %v", v.Valid("1234567892"), v.Valid("49927398716"))
+	}
+}
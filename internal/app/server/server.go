@@ -7,6 +7,7 @@ import (
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/config"
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/database"
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/handlers"
+	"github.com/chazari-x/yandex-pr-diplom/internal/app/notifier"
 	"github.com/chazari-x/yandex-pr-diplom/internal/app/worker"
 	"github.com/go-chi/chi/v5"
 )
@@ -32,7 +33,8 @@ func StartServer() error {
 		return err
 	}
 
-	c := handlers.NewController(conf, db, w)
+	n := notifier.NewNotifier(conf)
+	c := handlers.NewController(conf, db, w, n)
 
 	r := chi.NewRouter()
 
@@ -42,20 +44,132 @@ func StartServer() error {
 	r.Post("/api/user/login", c.PostLogin)
 	//аутентификация пользователя
 
-	r.Post("/api/user/orders", c.PostOrders)
-	//загрузка пользователем номера заказа для расчета
+	if n != nil {
+		r.Post("/api/user/password/reset", c.PostPasswordReset)
+		//запрос одноразового токена для сброса забытого пароля
 
-	r.Get("/api/user/orders", c.GetOrders)
-	//получение списка загруженные пользователем номеров заказов, статусов их обработки и информации о начислениях
+		r.Post("/api/user/password/reset/confirm", c.PostPasswordResetConfirm)
+		//установка нового пароля по токену сброса
+	}
+
+	if conf.OIDCIssuer != "" {
+		r.Get("/api/user/oidc/login", c.GetOIDCLogin)
+		//переход ко входу через внешний провайдер OpenID Connect
+
+		r.Get("/api/user/oidc/callback", c.GetOIDCCallback)
+		//возврат от провайдера: вход, регистрация или привязка внешней учетной записи
+	}
+
+	r.Post("/api/user/logout", c.PostLogout)
+	//завершение текущей сессии пользователя
+
+	r.Group(func(r chi.Router) {
+		r.Use(c.RequireUser)
+
+		r.With(c.RequireScope(handlers.ScopeOrdersWrite)).Post("/api/user/orders", c.PostOrders)
+		//загрузка пользователем номера заказа для расчета
+
+		r.With(c.RequireScope(handlers.ScopeOrdersWrite)).Post("/api/user/orders/batch", c.PostOrdersBatch)
+		//загрузка пакета номеров заказов одной транзакцией с результатом по каждому номеру
+
+		r.With(c.RequireScope(handlers.ScopeOrdersRead)).Get("/api/user/orders", c.GetOrders)
+		//получение списка загруженные пользователем номеров заказов, статусов их обработки и информации о начислениях
+
+		r.With(c.RequireScope(handlers.ScopeOrdersRead)).Get("/api/user/orders/{number}", c.GetOrder)
+		//статус, начисление, время загрузки и последней проверки одного заказа пользователя
+
+		r.With(c.RequireScope(handlers.ScopeOrdersRead)).Get("/api/user/orders/{number}/history", c.GetOrderHistory)
+		//история смены статусов заказа с временем каждого перехода
+
+		r.With(c.RequireScope(handlers.ScopeBalanceRead)).Get("/api/user/balance", c.GetBalance)
+		//получение текущего баланса счета баллов лояльности пользователя
+
+		r.With(c.RequireScope(handlers.ScopeWithdraw)).Post("/api/user/balance/withdraw", c.PostWithDraw)
+		//запрос на списание баллов с накопительного счета в счет оплаты нового заказа
+
+		r.With(c.RequireScope(handlers.ScopeBalanceRead)).Get("/api/user/withdrawals", c.GetWithDrawAls)
+		//получение информации о выводе средств накопительного счета пользователем
+
+		r.Group(func(r chi.Router) {
+			r.Use(c.SessionOnly)
+
+			r.Post("/api/user/2fa/verify", c.PostTwoFactorVerify)
+			//проверка второго фактора для текущей сессии
+
+			r.Group(func(r chi.Router) {
+				r.Use(c.RequireVerified)
+
+				r.Post("/api/user/password", c.PostPassword)
+				//смена пароля пользователя с завершением остальных его сессий
+
+				r.Post("/api/user/2fa/enroll", c.PostTwoFactorEnroll)
+				//выпуск секрета TOTP и otpauth-ссылки для приложения-аутентификатора
+
+				r.Post("/api/user/2fa/confirm", c.PostTwoFactorConfirm)
+				//включение 2FA по первому коду и выдача кодов восстановления
+
+				r.Delete("/api/user/2fa", c.DeleteTwoFactor)
+				//отключение 2FA
+
+				r.Get("/api/user/sessions", c.GetSessions)
+				//получение списка активных сессий пользователя
+
+				r.Delete("/api/user/sessions/{id}", c.DeleteSession)
+				//завершение сессии пользователя
+
+				r.Post("/api/user/keys", c.PostAPIKey)
+				//выпуск персонального API-ключа с ограниченными правами
+
+				r.Get("/api/user/keys", c.GetAPIKeys)
+				//получение списка API-ключей пользователя
+
+				r.Delete("/api/user/keys/{id}", c.DeleteAPIKey)
+				//отзыв API-ключа
+
+				r.Get("/api/user/security/events", c.GetSecurityEvents)
+				//получение последних событий безопасности учетной записи
+
+				r.Get("/api/user/profile", c.GetProfile)
+				//получение профиля пользователя с контактами и отметками об их подтверждении
+
+				r.Patch("/api/user/profile", c.PatchProfile)
+				//изменение email и телефона пользователя
+
+				if n != nil {
+					r.Post("/api/user/profile/{channel}/verify", c.PostContactVerify)
+					//отправка кода подтверждения на email или телефон
+
+					r.Post("/api/user/profile/{channel}/confirm", c.PostContactConfirm)
+					//подтверждение email или телефона кодом
+				}
+
+				r.Get("/api/user/export", c.GetExport)
+				//выгрузка всех данных учетной записи
+
+				r.Delete("/api/user", c.DeleteUser)
+				//удаление учетной записи с сохранением обезличенных финансовых записей
+			})
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(c.RequireRole(database.RoleSupport, database.RoleAdmin))
+
+		r.Delete("/api/admin/lockouts/{login}", c.DeleteLockout)
+		//снятие блокировки входа с учетной записи
+
+		r.Get("/api/admin/roles/{role}", c.GetRoleUsers)
+		//получение списка пользователей с ролью
 
-	r.Get("/api/user/balance", c.GetBalance)
-	//получение текущего баланса счета баллов лояльности пользователя
+		r.With(c.RequireRole(database.RoleAdmin)).Put("/api/admin/users/{login}/role", c.PutUserRole)
+		//назначение роли пользователю
 
-	r.Post("/api/user/balance/withdraw", c.PostWithDraw)
-	//запрос на списание баллов с накопительного счета в счет оплаты нового заказа
+		r.Get("/api/admin/orders/{number}/adjustments", c.GetAdjustments)
+		//получение корректировок начисления по заказу
 
-	r.Get("/api/user/withdrawals", c.GetWithDrawAls)
-	//получение информации о выводе средств накопительного счета пользователем
+		r.With(c.RequireRole(database.RoleAdmin)).Post("/api/admin/orders/{number}/adjustments", c.PostAdjustment)
+		//корректировка начисления по обработанному заказу: возврат, чарджбэк или доначисление
+	})
 
 	return http.ListenAndServe(conf.RunAddress, c.MiddlewaresConveyor(r))
 }
@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет "12345678901234567890" из тестовых векторов RFC 6238.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		time int64
+		want string
+	}{
+		{
+			name: "",
+			time: 59,
+			want: "287082",
+		},
+		{
+			name: "",
+			time: 1111111109,
+			want: "081804",
+		},
+		{
+			name: "",
+			time: 2000000000,
+			want: "279037",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Code(rfcSecret, time.Unix(tt.time, 0))
+			if err != nil {
+				t.Errorf("Code() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStep(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	counter := now.Unix() / int64(period.Seconds())
+
+	tests := []struct {
+		name     string
+		code     string
+		want     bool
+		wantStep int64
+	}{
+		{
+			name:     "Текущий период",
+			code:     "081804",
+			want:     true,
+			wantStep: counter,
+		},
+		{
+			name:     "Предыдущий период",
+			code:     mustCode(t, now.Add(-period)),
+			want:     true,
+			wantStep: counter - 1,
+		},
+		{
+			name: "Устаревший код",
+			code: mustCode(t, now.Add(-3*period)),
+			want: false,
+		},
+		{
+			name: "Неверный код",
+			code: "000000",
+			want: false,
+		},
+		{
+			name: "Неверный формат",
+			code: "81804",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateStep(rfcSecret, tt.code, now)
+			if ok != tt.want || ok && step != tt.wantStep {
+				t.Errorf("ValidateStep() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.want)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Gophermart", "username", rfcSecret)
+	if !strings.HasPrefix(got, "otpauth://totp/Gophermart:username?") || !strings.Contains(got, "secret="+rfcSecret) {
+		t.Errorf("URI() = %v", got)
+	}
+}
+
+func mustCode(t *testing.T, at time.Time) string {
+	c, err := Code(rfcSecret, at)
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+
+	return c
+}
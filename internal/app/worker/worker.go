@@ -2,6 +2,7 @@ package worker
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -80,6 +81,13 @@ func (c *worker) newWorker() {
 
 				resp.Body.Close()
 
+				// Система расчета ответила по заказу: время проверки обновляется, даже если статус не изменился.
+				if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent {
+					if err = c.db.TouchOrder(o.Number); err != nil {
+						log.Printf("go number: %s, err: %s", o.Number, err.Error())
+					}
+				}
+
 				switch resp.StatusCode {
 				case http.StatusOK:
 					var order OrderStr
@@ -99,9 +107,10 @@ func (c *worker) newWorker() {
 						log.Printf("go number: %s, status: %s", order.Number, order.Status)
 						go func(o, order OrderStr) {
 							if o.Status != order.Status {
-								err := c.db.UpdateOrder(order.Number, order.Status, order.Accrual)
+								err := c.db.UpdateOrder(order.Number, database.OrderStatus(order.Status), order.Accrual)
 								if err != nil {
 									log.Printf("go number: %s, err: %s", order.Number, err.Error())
+									c.retry(o)
 									return
 								}
 							}
@@ -113,10 +122,10 @@ func (c *worker) newWorker() {
 						log.Printf("go number: %s, status: %s, accrual: %g", order.Number, order.Status, order.Accrual)
 						go func(o OrderStr, order OrderStr) {
 							if o.Status != order.Status {
-								err := c.db.UpdateOrder(order.Number, order.Status, order.Accrual)
+								err := c.db.UpdateOrder(order.Number, database.OrderStatus(order.Status), order.Accrual)
 								if err != nil {
-									InputCh <- order
 									log.Printf("go number: %s, err: %s", o.Number, err.Error())
+									c.retry(o)
 									return
 								}
 							}
@@ -147,16 +156,14 @@ func (c *worker) newWorker() {
 				case http.StatusNoContent:
 					log.Printf("go number: %s, status: %s", o.Number, resp.Status)
 					go func(o OrderStr) {
-						if o.Status != "PROCESSING" {
-							err := c.db.UpdateOrder(o.Number, "PROCESSING", 0)
+						if o.Status != string(database.StatusProcessing) {
+							err := c.db.UpdateOrder(o.Number, database.StatusProcessing, 0)
 							if err != nil {
 								log.Printf("go number: %s, err: %s", o.Number, err.Error())
-								go func(o OrderStr) {
-									InputCh <- o
-								}(o)
+								c.retry(o)
 								return
 							}
-							o.Status = "PROCESSING"
+							o.Status = string(database.StatusProcessing)
 						}
 						go func(o OrderStr) {
 							InputCh <- o
@@ -172,3 +179,15 @@ func (c *worker) newWorker() {
 		}
 	}()
 }
+
+// retry возвращает заказ в очередь после неудачного обновления. Опрос прекращается, только если
+// в базе заказ уже в итоговом статусе (запоздавший ответ системы расчета его не изменит) или его нет.
+func (c *worker) retry(o OrderStr) {
+	status, err := c.db.GetOrderStatus(o.Number)
+	if errors.Is(err, database.ErrNotFound) || err == nil && status.Final() {
+		log.Printf("go number: %s, stop polling, status: %s", o.Number, status)
+		return
+	}
+
+	InputCh <- o
+}